@@ -0,0 +1,264 @@
+//go:build mage
+
+package main
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minGitHubAppKeyBits is the smallest RSA modulus accepted for the app key.
+// GitHub issues 2048-bit keys.
+const minGitHubAppKeyBits = 2048
+
+// githubAppKeyInfo summarises a validated GitHub App private key.
+type githubAppKeyInfo struct {
+	Path        string
+	Bits        int
+	Fingerprint string
+	Mode        os.FileMode
+}
+
+// loadGitHubAppKey parses a PKCS#1 or PKCS#8 RSA private key from a PEM file.
+func loadGitHubAppKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GitHub App key %s: %w", path, err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("GitHub App key %s is not PEM encoded (truncated or wrong file?)", path)
+	}
+	if block.Type == "ENCRYPTED PRIVATE KEY" || strings.Contains(block.Headers["Proc-Type"], "ENCRYPTED") {
+		return nil, fmt.Errorf("GitHub App key %s is passphrase-protected — use the unencrypted key downloaded from GitHub", path)
+	}
+
+	var key *rsa.PrivateKey
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+			return nil, fmt.Errorf("GitHub App key %s could not be parsed: %w", path, err)
+		}
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("GitHub App key %s could not be parsed: %w", path, err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("GitHub App key %s is %T, expected an RSA key", path, parsed)
+		}
+	default:
+		return nil, fmt.Errorf("GitHub App key %s has PEM type %q, expected an RSA private key", path, block.Type)
+	}
+
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("GitHub App key %s is invalid: %w", path, err)
+	}
+	return key, nil
+}
+
+// inspectGitHubAppKey validates the key at path and reports its size,
+// fingerprint and file permissions. When expectedFingerprint is set the key
+// must match it.
+func inspectGitHubAppKey(path, expectedFingerprint string) (githubAppKeyInfo, error) {
+	info := githubAppKeyInfo{Path: path}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		return info, fmt.Errorf("GitHub App key found but unreadable: %w", err)
+	}
+	info.Mode = stat.Mode().Perm()
+
+	key, err := loadGitHubAppKey(path)
+	if err != nil {
+		return info, err
+	}
+
+	info.Bits = key.N.BitLen()
+	if info.Bits < minGitHubAppKeyBits {
+		return info, fmt.Errorf("GitHub App key %s is only %d bits, expected at least %d", path, info.Bits, minGitHubAppKeyBits)
+	}
+
+	if info.Fingerprint, err = publicKeyFingerprint(&key.PublicKey); err != nil {
+		return info, err
+	}
+	if expectedFingerprint != "" {
+		want := strings.TrimPrefix(strings.TrimSpace(expectedFingerprint), "SHA256:")
+		if strings.TrimPrefix(info.Fingerprint, "SHA256:") != want {
+			return info, fmt.Errorf("GitHub App key %s has fingerprint %s, expected SHA256:%s", path, info.Fingerprint, want)
+		}
+	}
+	return info, nil
+}
+
+// publicKeyFingerprint returns the SHA256 fingerprint GitHub shows for app keys
+// (base64 of the SHA-256 digest of the DER-encoded public key).
+func publicKeyFingerprint(pub *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "SHA256:" + base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// expectedGitHubAppKeyFingerprint returns the configured public key fingerprint, if any.
+func expectedGitHubAppKeyFingerprint() string {
+	if env := os.Getenv("WIKI_APP_KEY_FINGERPRINT"); env != "" {
+		return env
+	}
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return ""
+	}
+	return cfg.Publish.GitHubApp.KeyFingerprint
+}
+
+// Where a resolved GitHub App key came from.
+const (
+	keySourceEnv    = "env"
+	keySourceSecret = "secret"
+	keySourceLocal  = "local"
+)
+
+// githubAppSecretPath is where Docker mounts the app key secret.
+const githubAppSecretPath = "/run/secrets/wiki_diagram_app_key"
+
+// keyDatePattern matches the date GitHub-downloaded keys are renamed with,
+// e.g. wiki-diagram-publisher.2025-10-01.private-key.pem.
+var keyDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+
+// githubAppKeyChoice is the key picked by resolveGitHubAppKey and why.
+type githubAppKeyChoice struct {
+	Path   string
+	Source string
+	Reason string
+}
+
+// keyCandidate is a local key file with the time it is ranked by.
+type keyCandidate struct {
+	path  string
+	when  time.Time
+	dated bool
+}
+
+// resolveGitHubAppKey picks the GitHub App private key every target uses:
+// the WIKI_APP_PRIVATE_KEY_PATH override, then the Docker secret mount, then
+// the newest local file in the key directory. Local files are ranked by the
+// date embedded in their name, falling back to their modification time.
+func resolveGitHubAppKey() (githubAppKeyChoice, error) {
+	// 1️⃣ Environment variable override
+	if keyPath := os.Getenv("WIKI_APP_PRIVATE_KEY_PATH"); keyPath != "" {
+		if _, err := os.Stat(keyPath); err != nil {
+			return githubAppKeyChoice{}, fmt.Errorf("GitHub App key missing at %s: %w", keyPath, err)
+		}
+		return reportKeyChoice(githubAppKeyChoice{keyPath, keySourceEnv, "set by WIKI_APP_PRIVATE_KEY_PATH"}), nil
+	}
+
+	// 2️⃣ Docker secret mount
+	if _, err := os.Stat(githubAppSecretPath); err == nil {
+		return reportKeyChoice(githubAppKeyChoice{githubAppSecretPath, keySourceSecret, "mounted as a Docker secret"}), nil
+	}
+
+	// 3️⃣ Local key search
+	dir, pattern := githubAppKeyLocation()
+	fmt.Printf("🔍 Searching for %s in: %s\n", pattern, dir)
+
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return githubAppKeyChoice{}, fmt.Errorf("error searching for GitHub App key in %s: %w", dir, err)
+	}
+	if len(matches) == 0 {
+		return githubAppKeyChoice{}, fmt.Errorf(`no GitHub App key found — expected one of:
+  - env var: WIKI_APP_PRIVATE_KEY_PATH
+  - Docker secret: %s
+  - local file: %s`, githubAppSecretPath, filepath.Join(dir, pattern))
+	}
+
+	candidates := make([]keyCandidate, 0, len(matches))
+	for _, m := range matches {
+		c, err := newKeyCandidate(m)
+		if err != nil {
+			return githubAppKeyChoice{}, err
+		}
+		candidates = append(candidates, c)
+	}
+	// Newest first; equal times fall back to name order so the answer is stable.
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if !candidates[i].when.Equal(candidates[j].when) {
+			return candidates[i].when.After(candidates[j].when)
+		}
+		return candidates[i].path > candidates[j].path
+	})
+
+	best := candidates[0]
+	reason := "newest by modification time " + best.when.Format(time.RFC3339)
+	if best.dated {
+		reason = "newest by embedded date " + best.when.Format("2006-01-02")
+	}
+	if len(candidates) > 1 {
+		var others []string
+		for _, c := range candidates[1:] {
+			others = append(others, filepath.Base(c.path))
+		}
+		reason += fmt.Sprintf(" (over %s)", strings.Join(others, ", "))
+	}
+	return reportKeyChoice(githubAppKeyChoice{best.path, keySourceLocal, reason}), nil
+}
+
+// newKeyCandidate dates a key file by the date in its name, or its mtime.
+func newKeyCandidate(path string) (keyCandidate, error) {
+	if m := keyDatePattern.FindString(filepath.Base(path)); m != "" {
+		if when, err := time.Parse("2006-01-02", m); err == nil {
+			return keyCandidate{path: path, when: when, dated: true}, nil
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return keyCandidate{}, fmt.Errorf("GitHub App key found but unreadable: %w", err)
+	}
+	return keyCandidate{path: path, when: info.ModTime()}, nil
+}
+
+// githubAppKeyLocation returns the search directory and glob pattern for local
+// keys: WIKI_APP_KEY_DIR / WIKI_APP_KEY_PATTERN, then diagrams.json.
+func githubAppKeyLocation() (string, string) {
+	dir, pattern := "~/.config/github-apps", "wiki-diagram-publisher*.pem"
+	if cfg, err := loadProjectConfig(); err == nil {
+		dir, pattern = cfg.Publish.GitHubApp.KeyDir, cfg.Publish.GitHubApp.KeyPattern
+	}
+	if env := os.Getenv("WIKI_APP_KEY_DIR"); env != "" {
+		dir = env
+	}
+	if env := os.Getenv("WIKI_APP_KEY_PATTERN"); env != "" {
+		pattern = env
+	}
+	return expandHome(dir), pattern
+}
+
+// reportKeyChoice prints which key won and why.
+func reportKeyChoice(c githubAppKeyChoice) githubAppKeyChoice {
+	fmt.Printf("📦 Using GitHub App key %s — %s\n", c.Path, c.Reason)
+	return c
+}
+
+// expandHome replaces a leading ~ with the user's home directory.
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, strings.TrimPrefix(path, "~"))
+}
@@ -0,0 +1,161 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// projectConfigPath holds repo-wide diagram settings.
+var projectConfigPath = "assets/diagrams/diagrams.json"
+
+// projectConfig is the parsed form of diagrams.json.
+type projectConfig struct {
+	DefaultTheme string                   `json:"defaultTheme"`
+	Variants     variantConfig            `json:"variants"`
+	PublicPath   string                   `json:"publicPath"`
+	Renderer     string                   `json:"renderer"`
+	Publish      publishConfig            `json:"publish"`
+	PostProcess  postProcessConfig        `json:"postProcess"`
+	Sizes        []sizeConfig             `json:"sizes"`
+	Diagrams     map[string]diagramConfig `json:"diagrams"`
+}
+
+// sizeConfig is one extra resolution written next to each diagram. Exactly one
+// of Scale and Width is set.
+type sizeConfig struct {
+	Suffix string  `json:"suffix"`          // appended to the diagram name, e.g. "@2x" or ".thumb"
+	Scale  float64 `json:"scale,omitempty"` // multiple of the diagram's CSS size
+	Width  int     `json:"width,omitempty"` // fixed pixel width, e.g. for thumbnails
+}
+
+// postProcessConfig controls the Go pipeline run on every rendered PNG.
+type postProcessConfig struct {
+	Trim     bool `json:"trim"`     // crop uniform background borders
+	Margin   int  `json:"margin"`   // background kept around the content when trimming, in CSS px
+	MaxWidth int  `json:"maxWidth"` // downscale wider images to this width; 0 disables
+	Quantize bool `json:"quantize"` // allow lossy palette quantisation
+	Colors   int  `json:"colors"`   // palette size, at most 256
+}
+
+// publishConfig holds the destinations rendered diagrams are published to.
+type publishConfig struct {
+	WikiJS    wikiJSConfig     `json:"wikijs"`
+	Git       gitPublishConfig `json:"git"`
+	GitHubApp githubAppConfig  `json:"githubApp"`
+}
+
+// githubAppConfig identifies the GitHub App used to mint push tokens. The
+// private key is discovered on disk, never stored here.
+type githubAppConfig struct {
+	AppID          string `json:"appId"`
+	InstallationID string `json:"installationId"`
+	APIURL         string `json:"apiUrl"`
+	KeyFingerprint string `json:"keyFingerprint"`
+	KeyDir         string `json:"keyDir"`
+	KeyPattern     string `json:"keyPattern"`
+}
+
+// gitPublishConfig describes the wiki repository diagrams are committed to.
+// Repo may be a URL or a local path (e.g. a bare repository for testing).
+type gitPublishConfig struct {
+	Repo        string `json:"repo"`
+	Branch      string `json:"branch"`
+	Path        string `json:"path"`
+	Workdir     string `json:"workdir"`
+	AuthorName  string `json:"authorName"`
+	AuthorEmail string `json:"authorEmail"`
+}
+
+// wikiJSConfig locates a Wiki.js instance. The API token is read from the
+// environment, never from this file.
+type wikiJSConfig struct {
+	URL    string `json:"url"`
+	Folder string `json:"folder"`
+}
+
+// variantConfig names the themes used for the dark and light copies of every diagram.
+// Leaving both empty disables variant output.
+type variantConfig struct {
+	Dark  string `json:"dark"`
+	Light string `json:"light"`
+}
+
+// diagramConfig holds per-diagram overrides, keyed by source name (without .md).
+// PostProcess may set any subset of the postProcessConfig fields.
+type diagramConfig struct {
+	Theme       string          `json:"theme,omitempty"`
+	PostProcess json.RawMessage `json:"postProcess,omitempty"`
+}
+
+// loadProjectConfig reads diagrams.json, falling back to defaults when it is absent.
+func loadProjectConfig() (projectConfig, error) {
+	cfg := projectConfig{DefaultTheme: "navy", PublicPath: "/assets/diagrams"}
+	cfg.Publish.WikiJS.Folder = "diagrams"
+	cfg.Publish.Git = gitPublishConfig{
+		Repo:        "https://github.com/henryhall897/homelabwiki.git",
+		Branch:      "main",
+		Path:        "assets/diagrams",
+		Workdir:     "build/publish/homelabwiki",
+		AuthorName:  "Wiki Diagram Publisher",
+		AuthorEmail: "actions@github.com",
+	}
+	cfg.Publish.GitHubApp.APIURL = "https://api.github.com"
+	cfg.Publish.GitHubApp.KeyDir = "~/.config/github-apps"
+	cfg.Publish.GitHubApp.KeyPattern = "wiki-diagram-publisher*.pem"
+	cfg.PostProcess = postProcessConfig{Trim: true, Margin: 24, Colors: 256}
+
+	data, err := os.ReadFile(projectConfigPath)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse %s: %w", projectConfigPath, err)
+	}
+	if cfg.DefaultTheme == "" {
+		cfg.DefaultTheme = "navy"
+	}
+	for _, size := range cfg.Sizes {
+		if size.Suffix == "" || (size.Scale > 0) == (size.Width > 0) {
+			return cfg, fmt.Errorf("invalid size %+v in %s: needs a suffix and exactly one of scale or width", size, projectConfigPath)
+		}
+	}
+	return cfg, nil
+}
+
+// variants returns the configured (variant, theme) pairs in dark, light order.
+func (c projectConfig) variants() [][2]string {
+	var out [][2]string
+	if c.Variants.Dark != "" {
+		out = append(out, [2]string{"dark", c.Variants.Dark})
+	}
+	if c.Variants.Light != "" {
+		out = append(out, [2]string{"light", c.Variants.Light})
+	}
+	return out
+}
+
+// themeFor returns the theme name selected for a diagram.
+func (c projectConfig) themeFor(name string) string {
+	if d, ok := c.Diagrams[name]; ok && d.Theme != "" {
+		return d.Theme
+	}
+	return c.DefaultTheme
+}
+
+// postProcessFor returns the post-processing settings for a diagram: the
+// project-wide settings with the diagram's overrides applied on top.
+func (c projectConfig) postProcessFor(name string) (postProcessConfig, error) {
+	pp := c.PostProcess
+	if d, ok := c.Diagrams[name]; ok && len(d.PostProcess) > 0 {
+		if err := json.Unmarshal(d.PostProcess, &pp); err != nil {
+			return pp, fmt.Errorf("invalid postProcess for %s in %s: %w", name, projectConfigPath, err)
+		}
+	}
+	return pp, nil
+}
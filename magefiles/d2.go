@@ -0,0 +1,198 @@
+//go:build mage
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/magefile/mage/mg"
+	"github.com/magefile/mage/sh"
+)
+
+// D2 namespace groups all D2 CLI–related tasks.
+type D2 mg.Namespace
+
+// TargetD2Version defines the pinned D2 version for reproducible builds.
+const TargetD2Version = "0.6.9"
+
+// D2 CLI version constraints, see checkToolVersion.
+const (
+	D2VersionRequired    = "~0.6"
+	D2VersionRecommended = "=" + TargetD2Version
+)
+
+// Built-in D2 themes the generated overrides are applied on top of: Neutral
+// Default for light backgrounds, Dark Mauve for dark ones.
+const (
+	d2LightThemeID = 0
+	d2DarkThemeID  = 200
+)
+
+// d2BaseThemeID picks the built-in theme matching the background's luminance,
+// so colours the overrides do not cover still suit it.
+func d2BaseThemeID(background string) int {
+	if isDark(background) {
+		return d2DarkThemeID
+	}
+	return d2LightThemeID
+}
+
+// Verify checks that the D2 CLI is installed and matches the target version.
+func (D2) Verify() error {
+	fmt.Println("Verifying D2 CLI installation...")
+
+	out, err := exec.Command("d2", "--version").CombinedOutput()
+	if err != nil {
+		return errors.New("❌ D2 CLI not found in PATH. Install it with:\n   go install oss.terrastruct.com/d2@v" + TargetD2Version)
+	}
+
+	version, err := checkToolVersion("D2 CLI", string(out), D2VersionRequired, D2VersionRecommended)
+	if err != nil {
+		return fmt.Errorf("❌ %w", err)
+	}
+
+	fmt.Printf("✅ D2 CLI %s verified successfully.\n", version)
+	return nil
+}
+
+// Deps ensures that the pinned D2 CLI is installed and verified.
+func (D2) Deps() error {
+	fmt.Println("Ensuring D2 CLI dependencies...")
+
+	if err := (D2{}).Verify(); err == nil {
+		fmt.Println("✅ D2 CLI already installed and up to date.")
+		return nil
+	}
+
+	fmt.Printf("Installing D2 CLI %s via go install...\n", TargetD2Version)
+	if err := sh.RunV("go", "install", "oss.terrastruct.com/d2@v"+TargetD2Version); err != nil {
+		return fmt.Errorf("failed to install D2 CLI %s: %w", TargetD2Version, err)
+	}
+
+	fmt.Println("Re-verifying D2 installation...")
+	if err := (D2{}).Verify(); err != nil {
+		return fmt.Errorf("D2 CLI installation did not verify successfully (is $(go env GOPATH)/bin in PATH?): %w", err)
+	}
+
+	fmt.Printf("✅ D2 CLI %s successfully installed and verified.\n", TargetD2Version)
+	return nil
+}
+
+// Version prints the currently installed D2 CLI version.
+func (D2) Version() error {
+	out, err := exec.Command("d2", "--version").CombinedOutput()
+	if err != nil {
+		return errors.New("D2 CLI not found in PATH.")
+	}
+	fmt.Printf("D2 CLI version: %s\n", strings.TrimSpace(string(out)))
+	return nil
+}
+
+// d2Version returns the output of d2 --version from the d2 that renders, on
+// the host or in the renderer image.
+func d2Version() (string, error) {
+	cmd, err := rendererCommand("d2", "d2", "--version")
+	if err != nil {
+		return "", err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run d2 --version: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// renderD2 renders a .d2 file to PNG with the theme overrides generated from
+// the theme colours prepended to the source.
+func renderD2(input, output string, t theme) error {
+	// Themes generated from a palette ship their own overrides; otherwise derive them.
+	themePath := filepath.Join(t.Dir, "theme.d2")
+	if _, err := os.Stat(themePath); err != nil {
+		themePath = filepath.Join(genD2Dir, t.Name+".theme.d2")
+		if err := writeD2Theme(t, themePath); err != nil {
+			return fmt.Errorf("failed to generate D2 theme: %w", err)
+		}
+	}
+
+	overrides, err := os.ReadFile(themePath)
+	if err != nil {
+		return err
+	}
+	src, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	// D2 lays text out with its own embedded fonts and ignores fontconfig, so
+	// the bundled fonts are passed as files when installed.
+	args := []string{"--pad", "100"}
+	for _, font := range [][2]string{{"--font-regular", "DejaVuSans.ttf"}, {"--font-bold", "DejaVuSans-Bold.ttf"}} {
+		if path := bundledFont(font[1]); path != "" {
+			args = append(args, font[0], path)
+		}
+	}
+	// "-" reads the diagram from stdin so the extracted source stays untouched.
+	cmd, err := rendererCommand("d2", "d2", append(args, "-", output)...)
+	if err != nil {
+		return err
+	}
+	cmd.Stdin = strings.NewReader(string(overrides) + "\n" + string(src))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	fmt.Printf("📙 Rendering with theme:\n   - %s\n", themePath)
+
+	return cmd.Run()
+}
+
+// d2ThemeOverrides maps the shared theme colours onto D2's theme colour codes.
+// N1–N7 are neutrals (N1 text, N7 background), B1–B6 base colours (B1 borders,
+// B4–B6 container and shape fills), AA*/AB* alternative accents.
+func d2ThemeOverrides(c themeColors) [][2]string {
+	return [][2]string{
+		{"N1", c.Text},
+		{"N2", c.Title},
+		{"N3", c.Line},
+		{"N4", c.Border},
+		{"N5", c.Secondary},
+		{"N6", c.Tertiary},
+		{"N7", c.Background},
+		{"B1", c.Border},
+		{"B2", c.Line},
+		{"B3", c.Border},
+		{"B4", c.Cluster},
+		{"B5", c.Secondary},
+		{"B6", c.Primary},
+		{"AA2", c.Border},
+		{"AA4", c.Note},
+		{"AA5", c.Secondary},
+		{"AB4", c.Note},
+		{"AB5", c.Tertiary},
+	}
+}
+
+// writeD2Theme writes a d2-config vars block carrying the theme overrides.
+func writeD2Theme(t theme, themePath string) error {
+	c, err := t.colors()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated from theme %q by mage. Do not edit.\n", t.Name)
+	fmt.Fprintf(&b, "vars: {\n  d2-config: {\n    theme-id: %d\n    theme-overrides: {\n", d2BaseThemeID(c.Background))
+	for _, kv := range d2ThemeOverrides(c) {
+		fmt.Fprintf(&b, "      %s: %q\n", kv[0], kv[1])
+	}
+	fmt.Fprintf(&b, "    }\n  }\n}\n")
+
+	if err := ensureDir(filepath.Dir(themePath)); err != nil {
+		return err
+	}
+	return os.WriteFile(themePath, []byte(b.String()), 0644)
+}
@@ -0,0 +1,57 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestD2BaseThemeID(t *testing.T) {
+	for bg, want := range map[string]int{"#1B1B2F": d2DarkThemeID, "#FAFAFC": d2LightThemeID, "#FFFFFF": d2LightThemeID, "#000000": d2DarkThemeID} {
+		if got := d2BaseThemeID(bg); got != want {
+			t.Errorf("d2BaseThemeID(%s) = %d, want %d", bg, got, want)
+		}
+	}
+}
+
+func TestRenderD2InContainer(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("DIAGRAMS_RENDERER", rendererContainer)
+
+	// The fake docker records its arguments and the source it was fed.
+	bin := filepath.Join(t.TempDir(), "docker")
+	script := "#!/bin/sh\necho \"$*\" > \"$(dirname \"$0\")/args\"\ncat > \"$(dirname \"$0\")/stdin\"\n"
+	if err := os.WriteFile(bin, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DOCKER_BIN", bin)
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "theme.d2"), []byte("vars: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("d.d2", []byte("a -> b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := renderD2("d.d2", "d.png", theme{Name: "test", Dir: dir}); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := os.ReadFile(filepath.Join(filepath.Dir(bin), "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(args), "run --rm -i ") || !strings.HasSuffix(string(args), " "+rendererImage+" d2 --pad 100 - d.png\n") {
+		t.Errorf("docker args = %q, want d2 run in %s", args, rendererImage)
+	}
+	stdin, err := os.ReadFile(filepath.Join(filepath.Dir(bin), "stdin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdin) != "vars: {}\n\na -> b\n" {
+		t.Errorf("d2 source = %q, want the theme overrides followed by the diagram", stdin)
+	}
+}
@@ -11,18 +11,28 @@ import (
 // Deps namespace coordinates dependency installation and verification for the entire repo.
 type Deps mg.Namespace
 
+// depStep is a named dependency check or installation step.
+type depStep struct {
+	name string
+	fn   func() error
+}
+
 // All runs all dependency checks sequentially.
 func (Deps) All() error {
 	fmt.Println("🔍 Ensuring all dependencies for Wiki-Diagrams are installed and verified...")
 
-	steps := []struct {
-		name string
-		fn   func() error
-	}{
+	steps := []depStep{
 		{"Go toolchain", func() error { return (Go{}).Deps() }},
 		{"Mermaid CLI", func() error { return (Mermaid{}).Deps() }},
+		{"Fonts", func() error { return (Fonts{}).Deps() }},
 		{"Git configuration", func() error { return (Git{}).Deps() }},
 	}
+	if sourcesUse("plantuml") {
+		steps = append(steps, depStep{"PlantUML", func() error { return (PlantUML{}).Deps() }})
+	}
+	if sourcesUse("d2") {
+		steps = append(steps, depStep{"D2 CLI", func() error { return (D2{}).Deps() }})
+	}
 
 	for _, step := range steps {
 		fmt.Printf("▶️  Starting: %s...\n", step.name)
@@ -43,14 +53,18 @@ func (Deps) All() error {
 func (Deps) Verify() error {
 	fmt.Println("🧭 Verifying installed dependencies for Wiki-Diagrams...")
 
-	steps := []struct {
-		name string
-		fn   func() error
-	}{
+	steps := []depStep{
 		{"Go toolchain", func() error { return (Go{}).Verify() }},
 		{"Mermaid CLI", func() error { return (Mermaid{}).Verify() }},
+		{"Fonts", func() error { return (Fonts{}).Verify() }},
 		{"Git availability", func() error { return (Git{}).Verify() }},
 	}
+	if sourcesUse("plantuml") {
+		steps = append(steps, depStep{"PlantUML", func() error { return (PlantUML{}).Verify() }})
+	}
+	if sourcesUse("d2") {
+		steps = append(steps, depStep{"D2 CLI", func() error { return (D2{}).Verify() }})
+	}
 
 	for _, step := range steps {
 		fmt.Printf("Checking: %s...\n", step.name)
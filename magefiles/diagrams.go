@@ -14,27 +14,60 @@ import (
 
 // Directory structure
 var (
-	srcMDDir  = "assets/diagrams/src/"
-	genMMDDir = "assets/diagrams/gen/mmd"
-	genPNGDir = "assets/diagrams/gen/png"
+	srcMDDir   = "assets/diagrams/src/"
+	genMMDDir  = "assets/diagrams/gen/mmd"
+	genPUMLDir = "assets/diagrams/gen/puml"
+	genD2Dir   = "assets/diagrams/gen/d2"
+	genPNGDir  = "assets/diagrams/gen/png"
+	genHTMLDir = "assets/diagrams/gen/html"
 	//mermaidCmd = "mmdc"
 	outputExt = "png"
+
+	puppeteerConfigPath = "assets/diagrams/puppeteer-config.json"
+	themeSampleDir      = "build/theme-samples"
 )
 
+// diagramRenderer describes how one fenced diagram language is extracted and rendered.
+type diagramRenderer struct {
+	fence   string // fence info string, e.g. "mermaid"
+	genDir  string // directory holding extracted sources
+	ext     string // extension of extracted sources
+	tool    string // renderer name recorded in provenance metadata
+	render  func(input, output string, t theme) error
+	version func() (string, error)
+
+	// renderAt, when set, renders at a chosen density (device pixels per CSS
+	// pixel) so sizes above the regular render's density are not capped.
+	renderAt func(input, output string, t theme, scale float64) error
+}
+
+// diagramRenderers lists every supported fence language.
+var diagramRenderers = []diagramRenderer{
+	{fence: "mermaid", genDir: genMMDDir, ext: ".mmd", tool: "mermaid-cli", render: renderFile, version: mermaidVersion, renderAt: renderFileAt},
+	{fence: "plantuml", genDir: genPUMLDir, ext: ".puml", tool: "plantuml", render: renderPlantUML, version: plantUMLVersion},
+	{fence: "d2", genDir: genD2Dir, ext: ".d2", tool: "d2", render: renderD2, version: d2Version},
+}
+
 // Diagrams namespace handles all diagram generation tasks.
 type Diagrams mg.Namespace
 
-// RenderAll extracts .mmd from all .md files, then generates .svg from them.
+// RenderAll extracts diagram sources from all .md files, then renders them to images.
 func (Diagrams) RenderAll() error {
 	fmt.Println("🎨 Rendering all diagrams from Markdown sources...")
 
-	if err := ensureDir(genMMDDir); err != nil {
+	if err := ensureDir(genPNGDir); err != nil {
 		return err
 	}
-	if err := ensureDir(genPNGDir); err != nil {
+
+	cfg, err := loadProjectConfig()
+	if err != nil {
 		return err
 	}
+	return renderAll(cfg, genPNGDir)
+}
 
+// renderAll renders every Markdown source into pngDir.
+func renderAll(cfg projectConfig, pngDir string) error {
 	// Walk through Markdown source files
 	return filepath.Walk(srcMDDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -44,18 +77,12 @@ func (Diagrams) RenderAll() error {
 			return nil
 		}
 
-		base := strings.TrimSuffix(filepath.Base(path), ".md")
-		mmdPath := filepath.Join(genMMDDir, base+".mmd")
-		svgPath := filepath.Join(genPNGDir, base+"."+outputExt)
-
 		fmt.Printf("→ %s\n", path)
-		if err := extractMMD(path, mmdPath); err != nil {
-			return fmt.Errorf("failed to extract MMD from %s: %w", path, err)
-		}
-		if err := renderFile(mmdPath, svgPath); err != nil {
-			return fmt.Errorf("failed to render SVG for %s: %w", base, err)
+		outPath, err := renderMarkdown(path, cfg, pngDir)
+		if err != nil {
+			return err
 		}
-		fmt.Printf("✅ Generated: %s\n", svgPath)
+		fmt.Printf("✅ Generated: %s\n", outPath)
 		return nil
 	})
 }
@@ -63,34 +90,229 @@ func (Diagrams) RenderAll() error {
 // RenderOne regenerates a specific diagram by name (without extension).
 func (Diagrams) RenderOne(name string) error {
 	mdPath := filepath.Join(srcMDDir, name+".md")
-	mmdPath := filepath.Join(genMMDDir, name+".mmd")
-	svgPath := filepath.Join(genPNGDir, name+"."+outputExt)
 
 	if _, err := os.Stat(mdPath); os.IsNotExist(err) {
 		return fmt.Errorf("markdown file not found: %s", mdPath)
 	}
 
-	fmt.Printf("🎯 Rendering %s.md → %s → %s\n", name, mmdPath, svgPath)
-	if err := extractMMD(mdPath, mmdPath); err != nil {
+	cfg, err := loadProjectConfig()
+	if err != nil {
 		return err
 	}
-	return renderFile(mmdPath, svgPath)
+
+	fmt.Printf("🎯 Rendering %s.md\n", name)
+	outPath, err := renderMarkdown(mdPath, cfg, genPNGDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Generated: %s\n", outPath)
+	return nil
 }
 
 // Clean removes all generated diagram outputs.
 func (Diagrams) Clean() error {
 	fmt.Println("🧹 Cleaning generated diagrams...")
-	if err := os.RemoveAll(genMMDDir); err != nil {
-		return err
+	for _, r := range diagramRenderers {
+		if err := os.RemoveAll(r.genDir); err != nil {
+			return err
+		}
 	}
 	if err := os.RemoveAll(genPNGDir); err != nil {
 		return err
 	}
+	if err := os.RemoveAll(genHTMLDir); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Themes lists the available themes and renders the sample diagram in each one.
+func (Diagrams) Themes() error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	themes, err := listThemes()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🎨 %d themes in %s (default: %s)\n", len(themes), themesDir, cfg.DefaultTheme)
+	for _, t := range themes {
+		fmt.Printf("   - %-10s %s  %s\n", t.Name, t.Background, t.Description)
+	}
+
+	if err := ensureDir(themeSampleDir); err != nil {
+		return err
+	}
+	for _, t := range themes {
+		outPath := filepath.Join(themeSampleDir, t.Name+"."+outputExt)
+		if err := renderFile(themeSamplePath, outPath, t); err != nil {
+			return fmt.Errorf("failed to render sample for theme %s: %w", t.Name, err)
+		}
+		fmt.Printf("✅ Generated: %s\n", outPath)
+	}
 	return nil
 }
 
-// extractMMD parses Markdown, extracts ```mermaid blocks, and writes to a .mmd file.
-func extractMMD(mdPath, mmdPath string) error {
+// renderMarkdown extracts the diagram fenced in a Markdown file and renders it
+// into pngDir with the matching renderer and the diagram's theme. It returns
+// the path of the rendered image. Picture snippets are only written for
+// renders into genPNGDir, and scratch renders extract their sources into
+// <pngDir>-src rather than gen/, so they leave the committed tree untouched.
+func renderMarkdown(mdPath string, cfg projectConfig, pngDir string) (string, error) {
+	r, err := detectRenderer(mdPath)
+	if err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(filepath.Base(mdPath), ".md")
+	t, err := loadTheme(cfg.themeFor(base))
+	if err != nil {
+		return "", err
+	}
+	pp, err := cfg.postProcessFor(base)
+	if err != nil {
+		return "", err
+	}
+	srcDir := r.genDir
+	if pngDir != genPNGDir {
+		srcDir = pngDir + "-src"
+	}
+	srcPath := filepath.Join(srcDir, base+r.ext)
+	outPath := filepath.Join(pngDir, base+"."+outputExt)
+
+	if err := extractDiagram(mdPath, srcPath, r.fence); err != nil {
+		return "", fmt.Errorf("failed to extract %s from %s: %w", r.fence, mdPath, err)
+	}
+	if err := ensureDir(filepath.Dir(outPath)); err != nil {
+		return "", err
+	}
+	if err := r.render(srcPath, outPath, t); err != nil {
+		return "", fmt.Errorf("failed to render %s for %s: %w", r.fence, base, err)
+	}
+	prov, err := diagramProvenance(mdPath, r, t.Name)
+	if err != nil {
+		return "", fmt.Errorf("failed to collect provenance for %s: %w", base, err)
+	}
+	if len(cfg.Sizes) > 0 {
+		// Sizes resample the raw render, before post-processing caps its width.
+		master, scale, err := sizeMaster(r, srcPath, outPath, t, cfg.Sizes, pp)
+		if err != nil {
+			return "", fmt.Errorf("failed to render the sizes master for %s: %w", base, err)
+		}
+		outs, err := writeSizes(master, outPath, cfg.Sizes, pp, scale, sizeCapHint(r))
+		if err != nil {
+			return "", fmt.Errorf("failed to write sizes for %s: %w", base, err)
+		}
+		for _, o := range outs {
+			if err := stampProvenance(o.Path, prov); err != nil {
+				return "", err
+			}
+			fmt.Printf("   ↳ %s: %dx%d\n", o.Path, o.Width, o.Height)
+		}
+		if pngDir == genPNGDir {
+			snippetPath, err := writeSrcsetSnippet(base, cfg, outs)
+			if err != nil {
+				return "", fmt.Errorf("failed to write srcset snippet for %s: %w", base, err)
+			}
+			if snippetPath != "" {
+				fmt.Printf("   ↳ snippet: %s\n", snippetPath)
+			}
+		}
+	}
+	res, err := postProcessPNG(outPath, pp.atDensity(nativeScale(r)))
+	if err != nil {
+		return "", err
+	}
+	fmt.Printf("   ↳ optimised: %s\n", res)
+	if err := stampProvenance(outPath, prov); err != nil {
+		return "", err
+	}
+
+	// Dark/light copies for pages that follow prefers-color-scheme
+	variants := cfg.variants()
+	for _, v := range variants {
+		vt, err := loadTheme(v[1])
+		if err != nil {
+			return "", err
+		}
+		variantPath := filepath.Join(pngDir, base+"."+v[0]+"."+outputExt)
+		if vt.Name == t.Name {
+			// Same theme as the main render; no need to launch the renderer again.
+			if err := copyFile(outPath, variantPath); err != nil {
+				return "", err
+			}
+		} else if err := r.render(srcPath, variantPath, vt); err != nil {
+			return "", fmt.Errorf("failed to render %s variant for %s: %w", v[0], base, err)
+		} else if _, err := postProcessPNG(variantPath, pp.atDensity(nativeScale(r))); err != nil {
+			return "", err
+		}
+		vprov := prov
+		vprov.Theme = vt.Name
+		if err := stampProvenance(variantPath, vprov); err != nil {
+			return "", err
+		}
+		fmt.Printf("   ↳ %s variant: %s\n", v[0], variantPath)
+	}
+	if len(variants) > 0 && pngDir == genPNGDir {
+		snippetPath, err := writePictureSnippet(base, cfg)
+		if err != nil {
+			return "", fmt.Errorf("failed to write picture snippet for %s: %w", base, err)
+		}
+		fmt.Printf("   ↳ snippet: %s\n", snippetPath)
+	}
+	return outPath, nil
+}
+
+// detectRenderer returns the renderer for the first supported fence in a Markdown file.
+func detectRenderer(mdPath string) (diagramRenderer, error) {
+	data, err := os.ReadFile(mdPath)
+	if err != nil {
+		return diagramRenderer{}, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		lang := fenceLanguage(line)
+		for _, r := range diagramRenderers {
+			if lang == r.fence {
+				return r, nil
+			}
+		}
+	}
+	return diagramRenderer{}, fmt.Errorf("no supported diagram block found in %s", mdPath)
+}
+
+// fenceLanguage returns the info string language of an opening ``` fence, or "".
+func fenceLanguage(line string) string {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "```") {
+		return ""
+	}
+	fields := strings.Fields(strings.TrimPrefix(trimmed, "```"))
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
+
+// sourcesUse reports whether any Markdown source contains a fence of the given language.
+func sourcesUse(fence string) bool {
+	found := false
+	filepath.Walk(srcMDDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || found || info.IsDir() || !strings.HasSuffix(path, ".md") {
+			return nil
+		}
+		if r, err := detectRenderer(path); err == nil && r.fence == fence {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// extractDiagram parses Markdown, extracts the ```<fence> blocks, and writes them to outPath.
+func extractDiagram(mdPath, outPath, fence string) error {
 	data, err := os.ReadFile(mdPath)
 	if err != nil {
 		return err
@@ -103,7 +325,7 @@ func extractMMD(mdPath, mmdPath string) error {
 	for _, line := range lines {
 		trimmed := strings.TrimSpace(line)
 		switch {
-		case strings.HasPrefix(trimmed, "```mermaid"):
+		case !inBlock && fenceLanguage(trimmed) == fence:
 			inBlock = true
 			continue
 		case strings.HasPrefix(trimmed, "```") && inBlock:
@@ -116,38 +338,67 @@ func extractMMD(mdPath, mmdPath string) error {
 	}
 
 	if len(output) == 0 {
-		return fmt.Errorf("no mermaid block found in %s", mdPath)
+		return fmt.Errorf("no %s block found in %s", fence, mdPath)
 	}
 
-	if err := ensureDir(filepath.Dir(mmdPath)); err != nil {
+	if err := ensureDir(filepath.Dir(outPath)); err != nil {
 		return err
 	}
-	return os.WriteFile(mmdPath, []byte(strings.Join(output, "\n")), 0644)
+	return os.WriteFile(outPath, []byte(strings.Join(output, "\n")), 0644)
+}
+
+// renderFile renders a .mmd file with mmdc using the given theme.
+func renderFile(input, output string, t theme) error {
+	return renderFileWith(mmdcCommand, input, output, t)
 }
 
-func renderFile(input, output string) error {
-	puppeteerConfig := "assets/diagrams/puppeteer-config.json"
-	mermaidConfig := "assets/diagrams/mermaid-config.json"
+// renderFileWith renders a .mmd file with the mmdc that command builds. Output
+// streams to the terminal unless command already redirected it.
+func renderFileWith(command func(args ...string) (*exec.Cmd, error), input, output string, t theme) error {
+	return renderMermaid(command, puppeteerConfigPath, input, output, t)
+}
+
+// renderMermaid renders a .mmd file with the given puppeteer config.
+func renderMermaid(command func(args ...string) (*exec.Cmd, error), puppeteerConfig, input, output string, t theme) error {
+	mermaidConfig := t.mermaidConfig()
 
-	cmd := exec.Command(
-		"mmdc",
+	args := []string{
 		"-i", input,
 		"-o", output,
 		"--configFile", mermaidConfig,
 		"--puppeteerConfigFile", puppeteerConfig,
-		"--backgroundColor", "#1B1B2F",
-	)
+		"--backgroundColor", t.Background,
+	}
+	if css := t.cssFile(); css != "" {
+		args = append(args, "--cssFile", css)
+	}
+	cmd, err := command(args...)
+	if err != nil {
+		return err
+	}
 
 	// Stream live logs to terminal
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
+	if cmd.Stdout == nil {
+		cmd.Stdout = os.Stdout
+	}
+	if cmd.Stderr == nil {
+		cmd.Stderr = os.Stderr
+	}
 
-	fmt.Printf("📘 Rendering with configs:\n   - %s\n   - %s\n", mermaidConfig, puppeteerConfig)
+	fmt.Printf("📘 Rendering with theme %s:\n   - %s\n   - %s\n", t.Name, mermaidConfig, puppeteerConfig)
 
 	return cmd.Run()
 }
 
+// copyFile copies src to dst, replacing dst if it exists.
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
 // ensureDir ensures a directory exists.
 func ensureDir(dir string) error {
 	return os.MkdirAll(dir, 0755)
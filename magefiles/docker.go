@@ -7,7 +7,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/magefile/mage/mg"
 	"github.com/magefile/mage/sh"
@@ -72,18 +74,17 @@ func (Docker) Deps() error {
 
 // verifyDockerEngine checks that Docker and Buildx are installed and reachable.
 func verifyDockerEngine() error {
-	if _, err := exec.LookPath("docker"); err != nil {
+	if _, err := exec.LookPath(dockerBin()); err != nil {
 		return fmt.Errorf("docker binary not found in PATH — please install Docker Engine")
 	}
 
-	cmd := exec.Command("docker", "version", "--format", "{{.Server.Version}}")
-	out, err := cmd.CombinedOutput()
+	out, err := dockerOutput("version", "--format", "{{.Server.Version}}")
 	if err != nil {
 		return fmt.Errorf("docker daemon not reachable: %w", err)
 	}
-	fmt.Printf("🐋 Docker Engine detected (version: %s)\n", strings.TrimSpace(string(out)))
+	fmt.Printf("🐋 Docker Engine detected (version: %s)\n", out)
 
-	if err := exec.Command("docker", "buildx", "version").Run(); err != nil {
+	if _, err := dockerOutput("buildx", "version"); err != nil {
 		return fmt.Errorf("docker buildx plugin missing — run: docker buildx install")
 	}
 
@@ -94,7 +95,7 @@ func verifyDockerEngine() error {
 
 // ensureDockerInstalled installs Docker Engine and dependencies if not already installed.
 func ensureDockerInstalled() error {
-	if _, err := exec.LookPath("docker"); err == nil {
+	if _, err := exec.LookPath(dockerBin()); err == nil {
 		return nil
 	}
 
@@ -123,51 +124,48 @@ func ensureDockerInstalled() error {
 
 // ensureBuildxConfigured ensures Docker Buildx is installed and functional.
 func ensureBuildxConfigured() error {
-	if err := exec.Command("docker", "buildx", "version").Run(); err == nil {
+	if _, err := dockerOutput("buildx", "version"); err == nil {
 		return nil
 	}
 	fmt.Println("⚙️  Installing Docker Buildx plugin...")
-	return sh.RunV("docker", "buildx", "install")
+	return dockerRun("buildx", "install")
 }
 
 // --- Secrets management ---
 
 // Secrets ensures the GitHub App private key is available for local or Swarm use.
+// In Swarm mode the key is published as a versioned secret, the same way
+// RotateSecret names it, unless a version already exists.
 func (Docker) Secrets() error {
 	fmt.Println("🔧 Ensuring GitHub App private key is available...")
 
-	const secretName = "wiki_diagram_app_key"
-	const swarmSecretPath = "/run/secrets/" + secretName
-
-	// Case 1: If Swarm secret already exists
-	if _, err := os.Stat(swarmSecretPath); err == nil {
-		fmt.Println("✅ GitHub App key available via Docker secret:", swarmSecretPath)
-		return nil
-	}
-
-	// Case 2: Look for local .pem file
-	home, _ := os.UserHomeDir()
-	searchDir := filepath.Join(home, ".config", "github-apps")
-	matches, err := filepath.Glob(filepath.Join(searchDir, "wiki-diagram-publisher*.pem"))
+	choice, err := resolveGitHubAppKey()
 	if err != nil {
-		return fmt.Errorf("error searching for GitHub App key in %s: %w", searchDir, err)
+		return err
 	}
-	if len(matches) == 0 {
-		return fmt.Errorf("no local GitHub App key found in %s — please download from GitHub App settings", searchDir)
+
+	// Case 1: Swarm secret already mounted
+	if choice.Source == keySourceSecret {
+		fmt.Println("✅ GitHub App key available via Docker secret:", choice.Path)
+		return nil
 	}
 
-	localKey := matches[len(matches)-1]
-	fmt.Printf("📦 Found local GitHub App key: %s\n", filepath.Base(localKey))
+	// Case 2: Env override or local .pem file
+	localKey := choice.Path
 
 	// Case 3: Only create a Docker secret if Swarm mode is active
-	out, _ := exec.Command("docker", "info", "--format", "{{.Swarm.ControlAvailable}}").Output()
-	if strings.TrimSpace(string(out)) == "true" {
-		fmt.Println("🐝 Swarm mode detected — creating Docker secret...")
-		if err := sh.RunV("docker", "secret", "create", secretName, localKey); err != nil {
-			if strings.Contains(err.Error(), "already exists") {
-				fmt.Println("ℹ️  Docker secret already exists, skipping creation.")
-				return nil
-			}
+	if out, _ := dockerOutput("info", "--format", "{{.Swarm.ControlAvailable}}"); out == "true" {
+		existing, err := appKeySecrets()
+		if err != nil {
+			return err
+		}
+		if len(existing) > 0 {
+			fmt.Printf("ℹ️  Docker secret %s already exists, skipping creation. Run mage docker:rotateSecret to publish a newer key.\n", existing[len(existing)-1])
+			return nil
+		}
+		name, _ := appKeySecretName(localKey)
+		fmt.Printf("🐝 Swarm mode detected — creating Docker secret %s...\n", name)
+		if err := dockerRun("secret", "create", name, localKey); err != nil {
 			return fmt.Errorf("failed to create Docker secret: %w", err)
 		}
 		fmt.Println("✅ Docker secret created successfully.")
@@ -178,47 +176,190 @@ func (Docker) Secrets() error {
 	return nil
 }
 
-// verifyGitHubAppKey searches for the GitHub App private key in known locations.
-// It supports date-suffixed filenames like wiki-diagram-publisher.YYYY-MM-DD.private-key.pem.
-func verifyGitHubAppKey() error {
-	const secretPath = "/run/secrets/wiki_diagram_app_key"
+// appKeySecret is the name services mount the GitHub App key under; the Swarm
+// secrets behind it are versioned as appKeySecret_v<date>.
+const appKeySecret = "wiki_diagram_app_key"
+
+// appKeySecretName returns the versioned secret name for the key file at
+// path. The version is the date in the file name, as GitHub-downloaded keys
+// are renamed; dated reports whether there was one, otherwise today is used.
+func appKeySecretName(path string) (name string, dated bool) {
+	if m := keyDatePattern.FindString(filepath.Base(path)); m != "" {
+		return appKeySecret + "_v" + m, true
+	}
+	return appKeySecret + "_v" + time.Now().Format("2006-01-02"), false
+}
 
-	// 1️⃣ Environment variable override
-	if keyPath := os.Getenv("WIKI_APP_PRIVATE_KEY_PATH"); keyPath != "" {
-		if _, err := os.Stat(keyPath); err != nil {
-			return fmt.Errorf("GitHub App key missing at %s: %w", keyPath, err)
+// appKeySecrets lists the existing GitHub App key secrets, the unversioned
+// original included, sorted by name.
+func appKeySecrets() ([]string, error) {
+	out, err := dockerOutput("secret", "ls", "--format", "{{.Name}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Docker secrets: %w", err)
+	}
+	var names []string
+	for _, name := range strings.Fields(out) {
+		if name == appKeySecret || strings.HasPrefix(name, appKeySecret+"_v") {
+			names = append(names, name)
 		}
-		fmt.Println("📦 Using GitHub App key from environment variable:", keyPath)
-		return nil
 	}
+	sort.Strings(names)
+	return names, nil
+}
 
-	// 2️⃣ Docker secret mount
-	if _, err := os.Stat(secretPath); err == nil {
-		fmt.Println("📦 Using GitHub App key from Docker secret:", secretPath)
-		return nil
+// verifyGitHubAppKey locates the GitHub App private key and validates its contents:
+// an unencrypted RSA key of adequate size, optionally matching a configured fingerprint.
+func verifyGitHubAppKey() error {
+	choice, err := resolveGitHubAppKey()
+	if err != nil {
+		return err
+	}
+	info, err := inspectGitHubAppKey(choice.Path, expectedGitHubAppKeyFingerprint())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🔐 RSA %d-bit key, fingerprint %s, mode %04o\n", info.Bits, info.Fingerprint, info.Mode)
+	// Swarm mounts secrets 0444 inside the container; only warn for files on disk.
+	if info.Mode&0o004 != 0 && choice.Source != keySourceSecret {
+		warnf("%s is world-readable — run: chmod 600 %s", choice.Path, choice.Path)
 	}
+	return nil
+}
+
+// --- Secret rotation ---
 
-	// 3️⃣ Local key search
-	home, _ := os.UserHomeDir()
-	searchDir := filepath.Join(home, ".config", "github-apps")
-	fmt.Println("🔍 Searching for key files in:", searchDir)
+// RotateSecret publishes the newest GitHub App key as a versioned Swarm secret
+// (wiki_diagram_app_key_v<date>), moves every service using an older version
+// onto it, and removes the old versions once all updates have converged.
+// Services keep reading the key from /run/secrets/wiki_diagram_app_key.
+// An undated key file whose version already exists is refused, since it
+// cannot be told apart from the key already in that secret.
+func (Docker) RotateSecret() error {
+	fmt.Println("🔄 Rotating GitHub App key Docker secret...")
 
-	matches, err := filepath.Glob(filepath.Join(searchDir, "wiki-diagram-publisher*.pem"))
+	choice, err := resolveGitHubAppKey()
 	if err != nil {
-		return fmt.Errorf("error searching for GitHub App key in %s: %w", searchDir, err)
+		return err
 	}
-	if len(matches) == 0 {
-		return fmt.Errorf(`no GitHub App key found — expected one of:
-  - env var: WIKI_APP_PRIVATE_KEY_PATH
-  - Docker secret: %s
-  - local file: ~/.config/github-apps/wiki-diagram-publisher*.pem`, secretPath)
+	if choice.Source == keySourceSecret {
+		return fmt.Errorf("cannot rotate from the mounted secret %s — point WIKI_APP_PRIVATE_KEY_PATH at the new key file", choice.Path)
+	}
+	if _, err := inspectGitHubAppKey(choice.Path, expectedGitHubAppKeyFingerprint()); err != nil {
+		return err
 	}
 
-	latestKey := matches[len(matches)-1]
-	if _, err := os.Stat(latestKey); err != nil {
-		return fmt.Errorf("GitHub App key found but unreadable: %w", err)
+	out, err := dockerOutput("info", "--format", "{{.Swarm.ControlAvailable}}")
+	if err != nil || out != "true" {
+		return fmt.Errorf("Docker Swarm manager not available — secret rotation requires swarm mode")
 	}
 
-	fmt.Println("💻 Using local GitHub App key:", latestKey)
+	newSecret, dated := appKeySecretName(choice.Path)
+
+	// Step 1: Find existing versions (including the unversioned original)
+	existing, err := appKeySecrets()
+	if err != nil {
+		return err
+	}
+	var oldSecrets []string
+	reuse := false
+	for _, name := range existing {
+		if name != newSecret {
+			oldSecrets = append(oldSecrets, name)
+			continue
+		}
+		// Only a dated file name ties the existing secret to this key; an
+		// undated key rotated twice in one day would otherwise keep the old one.
+		if !dated {
+			return fmt.Errorf("secret %s already exists and %s has no date in its name, so it cannot be told apart from the key in that secret — rename the key to include its date (e.g. wiki-diagram-publisher.%s.private-key.pem) and rerun",
+				newSecret, filepath.Base(choice.Path), time.Now().Format("2006-01-02"))
+		}
+		fmt.Printf("ℹ️  Secret %s already exists; reusing it.\n", newSecret)
+		reuse = true
+	}
+
+	// Step 2: Create the new version
+	if !reuse {
+		fmt.Printf("🔐 Creating secret %s from %s\n", newSecret, filepath.Base(choice.Path))
+		if err := dockerRun("secret", "create", newSecret, choice.Path); err != nil {
+			return fmt.Errorf("failed to create Docker secret %s: %w", newSecret, err)
+		}
+	}
+
+	// Step 3: Move services onto the new version
+	users, err := secretUsers()
+	if err != nil {
+		return err
+	}
+	for _, old := range oldSecrets {
+		for _, svc := range users[old] {
+			fmt.Printf("🐝 Updating service %s: %s → %s\n", svc, old, newSecret)
+			if err := dockerRun("service", "update", "--detach=false",
+				"--secret-rm", old,
+				"--secret-add", "source="+newSecret+",target="+appKeySecret,
+				svc,
+			); err != nil {
+				return fmt.Errorf("failed to update service %s (old secret %s kept): %w", svc, old, err)
+			}
+		}
+	}
+
+	// Step 4: Remove old versions nothing references any more
+	users, err = secretUsers()
+	if err != nil {
+		return err
+	}
+	for _, old := range oldSecrets {
+		if len(users[old]) > 0 {
+			fmt.Printf("⚠️  Keeping %s — still used by %s\n", old, strings.Join(users[old], ", "))
+			continue
+		}
+		fmt.Printf("🧹 Removing old secret %s\n", old)
+		if err := dockerRun("secret", "rm", old); err != nil {
+			return fmt.Errorf("failed to remove old secret %s: %w", old, err)
+		}
+	}
+
+	fmt.Printf("✅ GitHub App key rotated to %s.\n", newSecret)
 	return nil
 }
+
+// secretUsers maps secret names to the Swarm services that mount them.
+func secretUsers() (map[string][]string, error) {
+	out, err := dockerOutput("service", "ls", "--format", "{{.Name}}")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Docker services: %w", err)
+	}
+
+	users := map[string][]string{}
+	for _, svc := range strings.Fields(out) {
+		secrets, err := dockerOutput("service", "inspect", "--format",
+			"{{range .Spec.TaskTemplate.ContainerSpec.Secrets}}{{.SecretName}} {{end}}", svc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect service %s: %w", svc, err)
+		}
+		for _, name := range strings.Fields(secrets) {
+			users[name] = append(users[name], svc)
+		}
+	}
+	return users, nil
+}
+
+// dockerBin returns the docker CLI to run; DOCKER_BIN overrides it (e.g. with a fake for testing).
+func dockerBin() string {
+	if bin := os.Getenv("DOCKER_BIN"); bin != "" {
+		return bin
+	}
+	return "docker"
+}
+
+// dockerOutput runs the docker CLI and returns its trimmed stdout.
+func dockerOutput(args ...string) (string, error) {
+	out, err := exec.Command(dockerBin(), args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// dockerRun runs the docker CLI with output streamed to the terminal.
+func dockerRun(args ...string) error {
+	return sh.RunV(dockerBin(), args...)
+}
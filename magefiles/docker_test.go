@@ -0,0 +1,207 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeDockerScript is a docker CLI stand-in for a Swarm manager. It keeps
+// secrets and services as files under its state directory, records every
+// invocation in $state/log, and fails service updates while $state/fail-update
+// exists. Image digests are derived from the image reference.
+const fakeDockerScript = `#!/bin/sh
+state="$(dirname "$0")/state"
+echo "$*" >> "$state/log"
+case "$1 $2" in
+"info --format") echo true ;;
+"secret ls") cat "$state/secrets" ;;
+"secret inspect") grep -qx "$3" "$state/secrets" || { echo "no such secret: $3" >&2; exit 1; } ;;
+"secret create") echo "$3" >> "$state/secrets" ;;
+"secret rm") grep -vx "$3" "$state/secrets" > "$state/secrets.new"; mv "$state/secrets.new" "$state/secrets" ;;
+"service ls") ls "$state/services" ;;
+"service inspect") cat "$state/services/$5" ;;
+"buildx imagetools") printf 'sha256:%s\n' "$(printf %s "$6" | sha256sum | cut -c1-64)" ;;
+"service update")
+	if [ -e "$state/fail-update" ]; then echo "update out of sequence" >&2; exit 1; fi
+	old="$5"; new="${7#source=}"; new="${new%%,*}"; svc="$8"
+	sed "s/^$old\$/$new/" "$state/services/$svc" > "$state/svc.new"; mv "$state/svc.new" "$state/services/$svc" ;;
+*) echo "unexpected: $*" >&2; exit 2 ;;
+esac
+`
+
+// fakeDocker installs the fake CLI as DOCKER_BIN with the given secrets and
+// services (service name → mounted secrets) and returns its state directory.
+func fakeDocker(t *testing.T, secrets []string, services map[string][]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	state := filepath.Join(dir, "state")
+	if err := os.MkdirAll(filepath.Join(state, "services"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	bin := filepath.Join(dir, "docker")
+	write := func(path, content string, mode os.FileMode) {
+		if err := os.WriteFile(path, []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(bin, fakeDockerScript, 0755)
+	write(filepath.Join(state, "secrets"), strings.Join(secrets, "\n")+"\n", 0644)
+	write(filepath.Join(state, "log"), "", 0644)
+	for svc, names := range services {
+		write(filepath.Join(state, "services", svc), strings.Join(names, "\n")+"\n", 0644)
+	}
+	t.Setenv("DOCKER_BIN", bin)
+	return state
+}
+
+func readLines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Fields(string(data))
+}
+
+func TestRotateSecret(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, keyPath := testAppKeyFile(t, "wiki-diagram-publisher.2025-06-01.private-key.pem")
+	state := fakeDocker(t,
+		[]string{"wiki_diagram_app_key", "wiki_diagram_app_key_v2024-01-01", "unrelated"},
+		map[string][]string{
+			"pipeline": {"wiki_diagram_app_key_v2024-01-01"},
+			"legacy":   {"wiki_diagram_app_key", "unrelated"},
+			"web":      {"unrelated"},
+		})
+
+	if err := (Docker{}).RotateSecret(); err != nil {
+		t.Fatal(err)
+	}
+
+	log, err := os.ReadFile(filepath.Join(state, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"secret create wiki_diagram_app_key_v2025-06-01 " + keyPath,
+		"service update --detach=false --secret-rm wiki_diagram_app_key --secret-add source=wiki_diagram_app_key_v2025-06-01,target=wiki_diagram_app_key legacy",
+		"service update --detach=false --secret-rm wiki_diagram_app_key_v2024-01-01 --secret-add source=wiki_diagram_app_key_v2025-06-01,target=wiki_diagram_app_key pipeline",
+		"secret rm wiki_diagram_app_key",
+		"secret rm wiki_diagram_app_key_v2024-01-01",
+	} {
+		if !strings.Contains(string(log), want+"\n") {
+			t.Errorf("docker was not run with %q; log:\n%s", want, log)
+		}
+	}
+	if strings.Contains(string(log), "target=wiki_diagram_app_key web\n") || strings.Contains(string(log), "secret rm unrelated") {
+		t.Errorf("rotation touched unrelated services or secrets; log:\n%s", log)
+	}
+
+	if got := strings.Join(readLines(t, filepath.Join(state, "secrets")), " "); got != "unrelated wiki_diagram_app_key_v2025-06-01" {
+		t.Errorf("secrets after rotation = %s", got)
+	}
+	if got := strings.Join(readLines(t, filepath.Join(state, "services", "pipeline")), " "); got != "wiki_diagram_app_key_v2025-06-01" {
+		t.Errorf("pipeline mounts %s after rotation", got)
+	}
+}
+
+func TestRotateSecretFailedUpdateKeepsOldSecret(t *testing.T) {
+	t.Chdir(t.TempDir())
+	testAppKeyFile(t, "wiki-diagram-publisher.2025-06-01.private-key.pem")
+	state := fakeDocker(t,
+		[]string{"wiki_diagram_app_key_v2024-01-01"},
+		map[string][]string{"pipeline": {"wiki_diagram_app_key_v2024-01-01"}})
+	if err := os.WriteFile(filepath.Join(state, "fail-update"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := (Docker{}).RotateSecret()
+	if err == nil || !strings.Contains(err.Error(), "failed to update service pipeline (old secret wiki_diagram_app_key_v2024-01-01 kept)") {
+		t.Fatalf("RotateSecret error = %v, want the failed update reported", err)
+	}
+
+	log, err := os.ReadFile(filepath.Join(state, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(log), "secret rm") {
+		t.Errorf("a secret was removed after the failed update; log:\n%s", log)
+	}
+	if got := strings.Join(readLines(t, filepath.Join(state, "secrets")), " "); got != "wiki_diagram_app_key_v2024-01-01 wiki_diagram_app_key_v2025-06-01" {
+		t.Errorf("secrets after failed rotation = %s", got)
+	}
+	if got := strings.Join(readLines(t, filepath.Join(state, "services", "pipeline")), " "); got != "wiki_diagram_app_key_v2024-01-01" {
+		t.Errorf("pipeline mounts %s after failed rotation, want the old secret", got)
+	}
+}
+
+func TestDockerChecksUseDockerBin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	testAppKeyFile(t, "wiki-diagram-publisher.pem")
+	state := fakeDocker(t, []string{"wiki_diagram_app_key"}, nil)
+
+	if err := (Docker{}).Secrets(); err != nil {
+		t.Fatal(err)
+	}
+	log, err := os.ReadFile(filepath.Join(state, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(log), "secret ls --format {{.Name}}\n") || strings.Contains(string(log), "secret create") {
+		t.Errorf("Secrets with an existing secret ran:\n%s", log)
+	}
+}
+
+func TestSecretsCreatesVersionedSecret(t *testing.T) {
+	t.Chdir(t.TempDir())
+	_, keyPath := testAppKeyFile(t, "wiki-diagram-publisher.2025-06-01.private-key.pem")
+	state := fakeDocker(t, []string{"unrelated"}, nil)
+
+	if err := (Docker{}).Secrets(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(readLines(t, filepath.Join(state, "secrets")), " "); got != "unrelated wiki_diagram_app_key_v2025-06-01" {
+		t.Errorf("secrets = %s, want the key published as wiki_diagram_app_key_v2025-06-01 from %s", got, keyPath)
+	}
+}
+
+func TestRotateSecretSameDay(t *testing.T) {
+	today := "wiki_diagram_app_key_v" + time.Now().Format("2006-01-02")
+
+	// An undated key cannot be matched to the secret already holding today's version.
+	t.Chdir(t.TempDir())
+	testAppKeyFile(t, "wiki-diagram-publisher.pem")
+	state := fakeDocker(t, []string{today}, map[string][]string{"pipeline": {today}})
+	err := (Docker{}).RotateSecret()
+	if err == nil || !strings.Contains(err.Error(), "has no date in its name") {
+		t.Fatalf("undated same-day rotation: error = %v, want a refusal", err)
+	}
+	log, err := os.ReadFile(filepath.Join(state, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(log), "secret create") || strings.Contains(string(log), "secret rm") || strings.Contains(string(log), "service update") {
+		t.Errorf("refused rotation changed the swarm; log:\n%s", log)
+	}
+
+	// A dated key whose version exists reuses it and still moves older users over.
+	t.Chdir(t.TempDir())
+	testAppKeyFile(t, "wiki-diagram-publisher.2025-06-01.private-key.pem")
+	state = fakeDocker(t,
+		[]string{"wiki_diagram_app_key_v2025-06-01", "wiki_diagram_app_key_v2024-01-01"},
+		map[string][]string{"pipeline": {"wiki_diagram_app_key_v2024-01-01"}})
+	if err := (Docker{}).RotateSecret(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(readLines(t, filepath.Join(state, "secrets")), " "); got != "wiki_diagram_app_key_v2025-06-01" {
+		t.Errorf("secrets after reuse = %s", got)
+	}
+	if got := strings.Join(readLines(t, filepath.Join(state, "services", "pipeline")), " "); got != "wiki_diagram_app_key_v2025-06-01" {
+		t.Errorf("pipeline mounts %s after reuse", got)
+	}
+}
@@ -0,0 +1,292 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Doctor check outcomes.
+const (
+	doctorPass = "pass"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// doctorResult is one row of the doctor report.
+type doctorResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// doctorReport is the JSON form written for CI annotations.
+type doctorReport struct {
+	Generated time.Time      `json:"generated"`
+	Results   []doctorResult `json:"results"`
+}
+
+// doctorCheck runs one check and classifies its outcome.
+type doctorCheck struct {
+	name string
+	run  func() doctorResult
+}
+
+// Doctor runs every dependency check without stopping at the first failure and
+// prints a pass/warn/fail table with a fix hint for each problem. Set
+// DOCTOR_JSON to also write the report as JSON (e.g. for CI annotations).
+// It fails only when at least one check fails.
+func (Deps) Doctor() error {
+	fmt.Println("🩺 Running dependency doctor for Wiki-Diagrams...")
+
+	var results []doctorResult
+	for _, check := range doctorChecks() {
+		r := quietly(check.run)
+		r.Name = check.name
+		results = append(results, r)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL\tFIX")
+	failed := 0
+	for _, r := range results {
+		if r.Status == doctorFail {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.Name, strings.ToUpper(r.Status), truncate(r.Detail, 70), r.Hint)
+	}
+	w.Flush()
+
+	if path := os.Getenv("DOCTOR_JSON"); path != "" {
+		if err := ensureDir(filepath.Dir(path)); err != nil {
+			return err
+		}
+		if err := writeJSON(path, doctorReport{Generated: time.Now().UTC(), Results: results}); err != nil {
+			return fmt.Errorf("failed to write doctor report: %w", err)
+		}
+		fmt.Printf("📝 Report written to %s\n", path)
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(results))
+	}
+	return nil
+}
+
+// doctorChecks lists every check the doctor runs, in report order.
+func doctorChecks() []doctorCheck {
+	checks := []doctorCheck{
+		{"Go version", func() doctorResult {
+			return fromError(verifyGoVersion(), "Go "+TargetGoVersion, doctorFail, "mage go:deps")
+		}},
+		{"Mermaid CLI", func() doctorResult {
+			return fromError((Mermaid{}).Verify(), "mmdc "+TargetMermaidVersion+" ("+rendererMode()+")", doctorFail, "mage mermaid:deps")
+		}},
+		{"System libraries", checkSystemLibs},
+		{"Git identity", checkGitIdentity},
+		{"Docker engine", checkDocker},
+		{"GitHub App key", func() doctorResult {
+			return fromError(verifyGitHubAppKey(), "valid RSA key found", doctorWarn,
+				"download the key to ~/.config/github-apps/ or set WIKI_APP_PRIVATE_KEY_PATH")
+		}},
+		{"Fonts", checkFonts},
+		{"Config files", checkConfigFiles},
+	}
+	if sourcesUse("plantuml") {
+		checks = append(checks, doctorCheck{"PlantUML", func() doctorResult {
+			return fromError((PlantUML{}).Verify(), "PlantUML "+TargetPlantUMLVersion, doctorFail, "mage plantuml:deps")
+		}})
+	}
+	if sourcesUse("d2") {
+		checks = append(checks, doctorCheck{"D2 CLI", func() doctorResult {
+			return fromError((D2{}).Verify(), "d2 "+TargetD2Version, doctorFail, "mage d2:deps")
+		}})
+	}
+	return checks
+}
+
+// fromError turns a verify function's error into a result of the given severity.
+func fromError(err error, okDetail, severity, hint string) doctorResult {
+	if err == nil {
+		return doctorResult{Status: doctorPass, Detail: okDetail}
+	}
+	return doctorResult{Status: severity, Detail: firstLine(err.Error()), Hint: hint}
+}
+
+func checkSystemLibs() doctorResult {
+	if rendererMode() == rendererContainer {
+		return doctorResult{Status: doctorPass, Detail: "not needed with the container renderer"}
+	}
+	missing := missingSystemLibs()
+	if len(missing) == 0 {
+		return doctorResult{Status: doctorPass, Detail: "all Chromium libraries resolved"}
+	}
+	detail := fmt.Sprintf("%d missing: %s", len(missing), strings.Join(missing, " "))
+	if d, err := detectDistro(); err == nil {
+		if pkgs, unknown := d.packagesFor(missing); len(unknown) == 0 {
+			detail += fmt.Sprintf(" (%s: %s)", d.Name, strings.Join(pkgs, " "))
+		}
+	}
+	return doctorResult{Status: doctorFail, Detail: detail, Hint: "mage mermaid:verifySystemLibs"}
+}
+
+func checkGitIdentity() doctorResult {
+	name, _ := exec.Command("git", "config", "user.name").Output()
+	email, _ := exec.Command("git", "config", "user.email").Output()
+	if strings.TrimSpace(string(name)) == "" || strings.TrimSpace(string(email)) == "" {
+		return doctorResult{Status: doctorWarn, Detail: "user.name or user.email not set",
+			Hint: `git config --global user.name "Your Name" && git config --global user.email you@example.com`}
+	}
+	return doctorResult{Status: doctorPass,
+		Detail: fmt.Sprintf("%s <%s>", strings.TrimSpace(string(name)), strings.TrimSpace(string(email)))}
+}
+
+func checkDocker() doctorResult {
+	// Docker is only required when rendering in a container.
+	severity := doctorWarn
+	if rendererMode() == rendererContainer {
+		severity = doctorFail
+	}
+	return fromError(verifyDockerEngine(), "engine and buildx available", severity, "mage docker:deps")
+}
+
+func checkFonts() doctorResult {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return doctorResult{Status: doctorFail, Detail: err.Error(), Hint: "fix " + projectConfigPath}
+	}
+	t, err := loadTheme(cfg.DefaultTheme)
+	if err != nil {
+		return doctorResult{Status: doctorFail, Detail: err.Error(), Hint: "fix the theme in " + themesDir}
+	}
+	c, err := t.colors()
+	if err != nil {
+		return doctorResult{Status: doctorFail, Detail: err.Error(), Hint: "fix " + t.mermaidConfig()}
+	}
+
+	resolved, err := resolveFont(c.primaryFont())
+	if err != nil {
+		return doctorResult{Status: doctorWarn, Detail: "fc-match not available", Hint: "sudo apt-get install -y fontconfig"}
+	}
+	if !strings.EqualFold(resolved, c.primaryFont()) {
+		return doctorResult{Status: doctorWarn, Detail: fmt.Sprintf("%q resolves to %q", c.primaryFont(), resolved),
+			Hint: "mage fonts:deps"}
+	}
+	return doctorResult{Status: doctorPass, Detail: resolved}
+}
+
+func checkConfigFiles() doctorResult {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return doctorResult{Status: doctorFail, Detail: err.Error(), Hint: "fix " + projectConfigPath}
+	}
+
+	var problems []string
+	data, err := os.ReadFile(puppeteerConfigPath)
+	if err == nil {
+		err = json.Unmarshal(data, &map[string]any{})
+	}
+	if err != nil {
+		problems = append(problems, puppeteerConfigPath+": "+err.Error())
+	}
+
+	themes, err := listThemes()
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	names := map[string]bool{}
+	for _, t := range themes {
+		names[t.Name] = true
+		if _, err := t.colors(); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	for _, ref := range []string{cfg.DefaultTheme, cfg.Variants.Dark, cfg.Variants.Light} {
+		if ref != "" && !names[ref] {
+			problems = append(problems, fmt.Sprintf("theme %q is referenced but missing", ref))
+		}
+	}
+	for diagram, d := range cfg.Diagrams {
+		if d.Theme != "" && !names[d.Theme] {
+			problems = append(problems, fmt.Sprintf("diagram %s uses missing theme %q", diagram, d.Theme))
+		}
+	}
+
+	if len(problems) > 0 {
+		return doctorResult{Status: doctorFail, Detail: strings.Join(problems, "; "),
+			Hint: "fix " + projectConfigPath + " or " + themesDir}
+	}
+	return doctorResult{Status: doctorPass, Detail: fmt.Sprintf("%s, %d themes", filepath.Base(projectConfigPath), len(themes))}
+}
+
+// checkWarnings collects the warnings raised through warnf while a doctor
+// check runs; nil outside the doctor.
+var checkWarnings *[]string
+
+// warnf prints a warning that does not fail the current step. Inside a doctor
+// check it is also recorded, so the check reports WARN instead of PASS.
+func warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	fmt.Printf("⚠️  %s\n", msg)
+	if checkWarnings != nil {
+		*checkWarnings = append(*checkWarnings, msg)
+	}
+}
+
+// quietly runs a check with stdout discarded, so the progress output of the
+// reused verify functions does not interleave with the report. Warnings the
+// check raised are kept: a passing check becomes a warning, and every
+// warning is appended to the detail.
+func quietly(fn func() doctorResult) (r doctorResult) {
+	var warnings []string
+	checkWarnings = &warnings
+	defer func() {
+		checkWarnings = nil
+		if len(warnings) == 0 {
+			return
+		}
+		if r.Status == doctorPass {
+			r.Status = doctorWarn
+		}
+		r.Detail = strings.Join(append([]string{r.Detail}, warnings...), "; ")
+	}()
+
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return fn()
+	}
+	defer devNull.Close()
+
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() {
+		os.Stdout = stdout
+		if p := recover(); p != nil {
+			r = doctorResult{Status: doctorFail, Detail: fmt.Sprint(p)}
+		}
+	}()
+	return fn()
+}
+
+// firstLine returns the first line of a possibly multi-line message.
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// truncate shortens s to at most n runes for the table; JSON keeps the full text.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
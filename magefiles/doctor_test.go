@@ -0,0 +1,90 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuietlyKeepsWarnings(t *testing.T) {
+	r := quietly(func() doctorResult {
+		_, err := checkToolVersion("Go", "go version go1.25.0 linux/amd64", ">=1.25.0", "~1.26.0")
+		return fromError(err, "Go 1.25.0", doctorFail, "mage go:deps")
+	})
+	if r.Status != doctorWarn || !strings.HasPrefix(r.Detail, "Go 1.25.0; Go ") || !strings.Contains(r.Detail, "recommended") {
+		t.Errorf("outside the recommended range: %+v, want a warning naming the recommended range", r)
+	}
+
+	r = quietly(func() doctorResult {
+		_, err := checkToolVersion("Go", "go version go1.26.1 linux/amd64", ">=1.25.0", "~1.26.0")
+		return fromError(err, "Go 1.26.1", doctorFail, "mage go:deps")
+	})
+	if r.Status != doctorPass || r.Detail != "Go 1.26.1" {
+		t.Errorf("inside the recommended range: %+v, want a plain pass", r)
+	}
+
+	if checkWarnings != nil {
+		t.Error("warnings are still being collected after the check")
+	}
+}
+
+func TestDoctorReportsWorldReadableKey(t *testing.T) {
+	_, keyPath := testAppKeyFile(t, "wiki-diagram-publisher.pem")
+	if err := os.Chmod(keyPath, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	t.Setenv("GO_SKIP_LATEST_CHECK", "1")
+	t.Setenv("DOCKER_BIN", filepath.Join(t.TempDir(), "no-docker"))
+	reportPath := filepath.Join(t.TempDir(), "doctor.json")
+	t.Setenv("DOCTOR_JSON", reportPath)
+
+	// Capture the table; other checks may fail on this machine, which is fine.
+	tablePath := filepath.Join(t.TempDir(), "table.txt")
+	table, err := os.Create(tablePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = table
+	(Deps{}).Doctor()
+	os.Stdout = stdout
+	table.Close()
+
+	out, err := os.ReadFile(tablePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var row string
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "GitHub App key") {
+			row = line
+		}
+	}
+	if !strings.Contains(row, "WARN") || !strings.Contains(row, "valid RSA key found;") {
+		t.Errorf("table row = %q, want WARN for the world-readable key", row)
+	}
+
+	data, err := os.ReadFile(reportPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report doctorReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range report.Results {
+		if r.Name != "GitHub App key" {
+			continue
+		}
+		if r.Status != doctorWarn || !strings.Contains(r.Detail, keyPath+" is world-readable") {
+			t.Errorf("JSON result = %+v, want warn naming %s", r, keyPath)
+		}
+		return
+	}
+	t.Error("no GitHub App key result in the JSON report")
+}
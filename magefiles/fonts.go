@@ -0,0 +1,184 @@
+//go:build mage
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/magefile/mage/mg"
+)
+
+// Bundled fonts and the private fontconfig used only for rendering.
+const (
+	fontsDir           = "assets/fonts"
+	fontsChecksumsPath = "assets/fonts/fonts.sha256"
+	privateFontsDir    = "build/fonts"
+)
+
+// Fonts namespace groups the font tasks that keep diagram text consistent across machines.
+type Fonts mg.Namespace
+
+// Verify checks which family fontconfig resolves for each theme's configured
+// font, using the private fontconfig when installed, and warns on substitutions.
+func (Fonts) Verify() error {
+	fmt.Println("Verifying diagram fonts...")
+
+	fonts, err := configuredFonts()
+	if err != nil {
+		return err
+	}
+
+	for _, font := range fonts {
+		resolved, err := resolveFont(font)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(resolved, font) {
+			fmt.Printf("⚠️  %q resolves to %q; text widths will differ from machines that have it.\n", font, resolved)
+			if privateFontconfig() == "" {
+				fmt.Println("   Install the bundled fonts with: mage fonts:deps")
+			}
+			continue
+		}
+		fmt.Printf("✅ %q resolves to %q.\n", font, resolved)
+	}
+	return nil
+}
+
+// Deps installs the bundled fonts from assets/fonts into a private fontconfig
+// directory (build/fonts) after checking them against fonts.sha256, then verifies.
+func (Fonts) Deps() error {
+	fmt.Println("Ensuring diagram fonts...")
+
+	if err := installBundledFonts(); err != nil {
+		return fmt.Errorf("failed to install bundled fonts: %w", err)
+	}
+	return (Fonts{}).Verify()
+}
+
+// installBundledFonts copies every checksummed font file into build/fonts and
+// writes the fontconfig file rendererCommand points FONTCONFIG_FILE at.
+func installBundledFonts() error {
+	sums, err := readChecksumTable(fontsChecksumsPath)
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(fontsDir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".ttf", ".otf", ".ttc":
+			files = append(files, e.Name())
+		}
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no font files in %s", fontsDir)
+	}
+	sort.Strings(files)
+
+	dest := filepath.Join(privateFontsDir, "files")
+	if err := os.RemoveAll(dest); err != nil {
+		return err
+	}
+	if err := ensureDir(dest); err != nil {
+		return err
+	}
+
+	for _, name := range files {
+		src := filepath.Join(fontsDir, name)
+		sum, ok := sums[name]
+		if !ok {
+			return fmt.Errorf("%s is not listed in %s", src, fontsChecksumsPath)
+		}
+		if err := verifySHA256(src, sum); err != nil {
+			return err
+		}
+		if err := copyFile(src, filepath.Join(dest, name)); err != nil {
+			return err
+		}
+		fmt.Printf("   ↳ %s\n", name)
+	}
+
+	// Relative paths resolve against the config file, so the same file works
+	// on the host and inside the renderer image (repo mounted at /work). Only
+	// the bundled fonts are listed: system fonts can never be substituted in.
+	conf := `<?xml version="1.0"?>
+<!DOCTYPE fontconfig SYSTEM "urn:fontconfig:fonts.dtd">
+<!-- Generated by mage fonts:deps; used only when rendering diagrams. -->
+<fontconfig>
+  <dir prefix="relative">files</dir>
+  <cachedir prefix="relative">cache</cachedir>
+</fontconfig>
+`
+	confPath := filepath.Join(privateFontsDir, "fonts.conf")
+	if err := os.WriteFile(confPath, []byte(conf), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Installed %d bundled fonts; rendering uses %s.\n", len(files), confPath)
+	return nil
+}
+
+// bundledFont returns the installed copy of a bundled font file, or "" if the
+// bundled fonts are not installed. D2 ignores fontconfig and takes font files.
+func bundledFont(name string) string {
+	path := filepath.Join(privateFontsDir, "files", name)
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// privateFontconfig returns the fontconfig file written by Fonts.Deps, or ""
+// if the bundled fonts are not installed.
+func privateFontconfig() string {
+	path := filepath.Join(privateFontsDir, "fonts.conf")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// configuredFonts returns the distinct primary font families of all themes.
+func configuredFonts() ([]string, error) {
+	themes, err := listThemes()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var fonts []string
+	for _, t := range themes {
+		c, err := t.colors()
+		if err != nil {
+			return nil, err
+		}
+		if font := c.primaryFont(); font != "" && !seen[font] {
+			seen[font] = true
+			fonts = append(fonts, font)
+		}
+	}
+	return fonts, nil
+}
+
+// resolveFont returns the family fontconfig picks for font, where the
+// renderer runs and with the same FONTCONFIG_FILE.
+func resolveFont(font string) (string, error) {
+	cmd, err := rendererCommand("fc-match", "fc-match", "-f", "%{family}", font)
+	if err != nil {
+		return "", err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", errors.New("❌ fc-match failed. Install fontconfig with:\n   sudo apt-get install -y fontconfig")
+	}
+	return strings.Split(strings.TrimSpace(string(out)), ",")[0], nil
+}
@@ -0,0 +1,59 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestInstallBundledFontsIsPrivate(t *testing.T) {
+	repoFonts, err := filepath.Abs(filepath.Join("..", fontsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(fontsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"DejaVuSans.ttf", "DejaVuSans-Bold.ttf", "fonts.sha256"} {
+		if err := copyFile(filepath.Join(repoFonts, name), filepath.Join(fontsDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if privateFontconfig() != "" || bundledFont("DejaVuSans.ttf") != "" {
+		t.Fatal("fonts reported as installed before installBundledFonts")
+	}
+	if err := installBundledFonts(); err != nil {
+		t.Fatal(err)
+	}
+
+	conf, err := os.ReadFile(privateFontconfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(conf), "<include") || strings.Contains(string(conf), "/etc/fonts") {
+		t.Errorf("fonts.conf pulls in the system configuration:\n%s", conf)
+	}
+	for _, want := range []string{`<dir prefix="relative">files</dir>`, `<cachedir prefix="relative">cache</cachedir>`} {
+		if !strings.Contains(string(conf), want) {
+			t.Errorf("fonts.conf lacks %s", want)
+		}
+	}
+	if got := bundledFont("DejaVuSans-Bold.ttf"); got != filepath.Join(privateFontsDir, "files", "DejaVuSans-Bold.ttf") {
+		t.Errorf("bundledFont = %q", got)
+	}
+
+	cmd, err := hostCommand("java", "-version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs(privateFontconfig())
+	if !slices.Contains(cmd.Env, "FONTCONFIG_FILE="+abs) {
+		t.Errorf("host command environment lacks FONTCONFIG_FILE=%s", abs)
+	}
+}
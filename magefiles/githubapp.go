@@ -0,0 +1,188 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// githubAppToken is an installation access token minted for the GitHub App.
+type githubAppToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AppToken mints a GitHub App installation token with the discovered key and
+// reports its expiry. The token itself is never printed.
+func (Publish) AppToken() error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	g, err := resolveGitPublishConfig(cfg)
+	if err != nil {
+		return err
+	}
+	tok, err := mintGitHubAppToken(cfg.Publish.GitHubApp, g.Repo)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Installation token minted (expires %s).\n", tok.ExpiresAt.Local().Format(time.RFC1123))
+	return nil
+}
+
+// mintGitHubAppToken loads the app key, signs a JWT and exchanges it for an
+// installation token. The installation is looked up from repo, the resolved
+// publish repository, unless an installation id is configured.
+func mintGitHubAppToken(app githubAppConfig, repo string) (githubAppToken, error) {
+	if env := os.Getenv("WIKI_DIAGRAM_APP_ID"); env != "" {
+		app.AppID = env
+	}
+	if env := os.Getenv("WIKI_DIAGRAM_INSTALLATION_ID"); env != "" {
+		app.InstallationID = env
+	}
+	if env := os.Getenv("GITHUB_API_URL"); env != "" {
+		app.APIURL = env
+	}
+	if app.APIURL == "" {
+		app.APIURL = "https://api.github.com"
+	}
+	if app.AppID == "" {
+		return githubAppToken{}, errors.New("❌ GitHub App id not configured — set publish.githubApp.appId in diagrams.json or WIKI_DIAGRAM_APP_ID")
+	}
+
+	choice, err := resolveGitHubAppKey()
+	if err != nil {
+		return githubAppToken{}, err
+	}
+	key, err := loadGitHubAppKey(choice.Path)
+	if err != nil {
+		return githubAppToken{}, err
+	}
+	jwt, err := githubAppJWT(app.AppID, key, time.Now())
+	if err != nil {
+		return githubAppToken{}, err
+	}
+
+	client := githubAPIClient{baseURL: strings.TrimSuffix(app.APIURL, "/"), http: &http.Client{Timeout: 30 * time.Second}}
+
+	installationID := app.InstallationID
+	if installationID == "" {
+		slug, err := githubRepoSlug(repo)
+		if err != nil {
+			return githubAppToken{}, err
+		}
+		if installationID, err = client.installationID(jwt, slug); err != nil {
+			return githubAppToken{}, err
+		}
+	}
+
+	fmt.Printf("🔑 Minting installation token for app %s (installation %s)\n", app.AppID, installationID)
+	return client.accessToken(jwt, installationID)
+}
+
+// githubAppJWT signs the short-lived RS256 JWT GitHub expects from an app.
+// iat is backdated a minute to allow for clock drift; exp stays under the
+// ten-minute maximum.
+func githubAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	enc := base64.RawURLEncoding
+	signingInput := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App JWT: %w", err)
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
+
+// githubAPIClient is a minimal GitHub REST client for the app endpoints.
+type githubAPIClient struct {
+	baseURL string
+	http    *http.Client
+}
+
+// installationID looks up the app installation for an owner/repo slug.
+func (c githubAPIClient) installationID(jwt, repo string) (string, error) {
+	var out struct {
+		ID int64 `json:"id"`
+	}
+	if err := c.do(http.MethodGet, "/repos/"+repo+"/installation", jwt, &out); err != nil {
+		return "", fmt.Errorf("failed to find GitHub App installation for %s: %w", repo, err)
+	}
+	return strconv.FormatInt(out.ID, 10), nil
+}
+
+// accessToken exchanges the app JWT for an installation token.
+func (c githubAPIClient) accessToken(jwt, installationID string) (githubAppToken, error) {
+	var tok githubAppToken
+	if err := c.do(http.MethodPost, "/app/installations/"+installationID+"/access_tokens", jwt, &tok); err != nil {
+		return tok, fmt.Errorf("failed to mint installation token: %w", err)
+	}
+	if tok.Token == "" {
+		return tok, errors.New("GitHub returned an empty installation token")
+	}
+	return tok, nil
+}
+
+func (c githubAPIClient) do(method, path, jwt string, out any) error {
+	req, err := http.NewRequest(method, c.baseURL+path, bytes.NewReader(nil))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("X-GitHub-Api-Version", "2022-11-28")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// githubRepoSlug extracts owner/repo from a GitHub HTTPS or SSH remote.
+func githubRepoSlug(remote string) (string, error) {
+	s := strings.TrimSuffix(strings.TrimSpace(remote), ".git")
+	for _, prefix := range []string{"https://github.com/", "http://github.com/", "git@github.com:", "ssh://git@github.com/"} {
+		if strings.HasPrefix(s, prefix) {
+			slug := strings.TrimPrefix(s, prefix)
+			if strings.Count(slug, "/") == 1 {
+				return slug, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("cannot derive owner/repo from %q — set publish.githubApp.installationId", remote)
+}
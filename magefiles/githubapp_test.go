@@ -0,0 +1,252 @@
+//go:build mage
+
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testAppKey generates an RSA key and writes it where WIKI_APP_PRIVATE_KEY_PATH
+// points.
+func testAppKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, _ := testAppKeyFile(t, "wiki-diagram-publisher.pem")
+	return key
+}
+
+// testAppKeyFile is testAppKey with a chosen file name, returning its path too.
+func testAppKeyFile(t *testing.T, name string) (*rsa.PrivateKey, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("WIKI_APP_PRIVATE_KEY_PATH", path)
+	return key, path
+}
+
+// verifyAppJWT checks an RS256 app JWT against pub and returns its claims.
+func verifyAppJWT(jwt string, pub *rsa.PublicKey) (map[string]any, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("JWT has %d parts", len(parts))
+	}
+	enc := base64.RawURLEncoding
+
+	var header map[string]string
+	if raw, err := enc.DecodeString(parts[0]); err != nil || json.Unmarshal(raw, &header) != nil {
+		return nil, fmt.Errorf("bad JWT header %q", parts[0])
+	}
+	if header["alg"] != "RS256" || header["typ"] != "JWT" {
+		return nil, fmt.Errorf("JWT header = %v, want RS256/JWT", header)
+	}
+
+	sig, err := enc.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig); err != nil {
+		return nil, fmt.Errorf("JWT signature: %w", err)
+	}
+
+	var claims map[string]any
+	raw, err := enc.DecodeString(parts[1])
+	if err != nil {
+		return nil, err
+	}
+	return claims, json.Unmarshal(raw, &claims)
+}
+
+func TestGitHubAppJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	jwt, err := githubAppJWT("12345", key, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := verifyAppJWT(jwt, &key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["iss"] != "12345" {
+		t.Errorf("iss = %v, want 12345", claims["iss"])
+	}
+	iat, exp := int64(claims["iat"].(float64)), int64(claims["exp"].(float64))
+	if iat != now.Unix()-60 {
+		t.Errorf("iat = %d, want a minute before now (%d)", iat, now.Unix()-60)
+	}
+	if exp <= now.Unix() || exp-iat > 600 {
+		t.Errorf("exp = %d: must be after now and at most ten minutes after iat %d", exp, iat)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyAppJWT(jwt, &other.PublicKey); err == nil {
+		t.Error("JWT verified against the wrong public key")
+	}
+}
+
+// fakeGitHubAPI serves the two app endpoints, rejecting JWTs not signed by key.
+func fakeGitHubAPI(t *testing.T, key *rsa.PrivateKey, installationStatus, tokenStatus int) (*httptest.Server, *[]string) {
+	var calls []string
+	checkJWT := func(w http.ResponseWriter, r *http.Request) bool {
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		claims, err := verifyAppJWT(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), &key.PublicKey)
+		if err != nil || claims["iss"] != "12345" {
+			t.Errorf("%s %s: bad app JWT: %v (claims %v)", r.Method, r.URL.Path, err, claims)
+			http.Error(w, `{"message":"A JSON web token could not be decoded"}`, http.StatusUnauthorized)
+			return false
+		}
+		if got := r.Header.Get("Accept"); got != "application/vnd.github+json" {
+			t.Errorf("Accept = %q", got)
+		}
+		return true
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /repos/henryhall897/homelabwiki/installation", func(w http.ResponseWriter, r *http.Request) {
+		if !checkJWT(w, r) {
+			return
+		}
+		if installationStatus != http.StatusOK {
+			http.Error(w, `{"message":"Not Found"}`, installationStatus)
+			return
+		}
+		w.Write([]byte(`{"id":4242,"account":{"login":"henryhall897"}}`))
+	})
+	mux.HandleFunc("POST /app/installations/4242/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		if !checkJWT(w, r) {
+			return
+		}
+		if tokenStatus != http.StatusCreated {
+			http.Error(w, `{"message":"Bad credentials"}`, tokenStatus)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"token":"ghs_test","expires_at":"2030-01-01T00:00:00Z"}`))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// appTokenConfig returns the default project config with the app pointed at
+// the stub API through the environment overrides.
+func appTokenConfig(t *testing.T, apiURL string) projectConfig {
+	t.Helper()
+	t.Chdir(t.TempDir())
+	t.Setenv("GITHUB_API_URL", apiURL)
+	t.Setenv("WIKI_DIAGRAM_APP_ID", "12345")
+	t.Setenv("WIKI_DIAGRAM_INSTALLATION_ID", "")
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestMintGitHubAppToken(t *testing.T) {
+	key := testAppKey(t)
+	srv, calls := fakeGitHubAPI(t, key, http.StatusOK, http.StatusCreated)
+	cfg := appTokenConfig(t, srv.URL+"/")
+
+	tok, err := mintGitHubAppToken(cfg.Publish.GitHubApp, cfg.Publish.Git.Repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tok.Token != "ghs_test" || !tok.ExpiresAt.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("token = %+v", tok)
+	}
+	want := "GET /repos/henryhall897/homelabwiki/installation,POST /app/installations/4242/access_tokens"
+	if got := strings.Join(*calls, ","); got != want {
+		t.Errorf("calls = %s, want %s", got, want)
+	}
+
+	// A configured installation id skips the lookup.
+	*calls = nil
+	t.Setenv("WIKI_DIAGRAM_INSTALLATION_ID", "4242")
+	if _, err := mintGitHubAppToken(cfg.Publish.GitHubApp, cfg.Publish.Git.Repo); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(*calls, ","); got != "POST /app/installations/4242/access_tokens" {
+		t.Errorf("calls with a configured installation = %s", got)
+	}
+}
+
+func TestMintGitHubAppTokenErrors(t *testing.T) {
+	key := testAppKey(t)
+	for _, tc := range []struct {
+		name                            string
+		installationStatus, tokenStatus int
+		want                            string
+	}{
+		{
+			name:               "installation not found",
+			installationStatus: http.StatusNotFound,
+			tokenStatus:        http.StatusCreated,
+			want:               `failed to find GitHub App installation for henryhall897/homelabwiki: GET /repos/henryhall897/homelabwiki/installation returned 404 Not Found: {"message":"Not Found"}`,
+		},
+		{
+			name:               "token rejected",
+			installationStatus: http.StatusOK,
+			tokenStatus:        http.StatusUnauthorized,
+			want:               `failed to mint installation token: POST /app/installations/4242/access_tokens returned 401 Unauthorized: {"message":"Bad credentials"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := fakeGitHubAPI(t, key, tc.installationStatus, tc.tokenStatus)
+			cfg := appTokenConfig(t, srv.URL)
+			_, err := mintGitHubAppToken(cfg.Publish.GitHubApp, cfg.Publish.Git.Repo)
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("error = %v\nwant %s", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAppTokenUsesPublishGitRepoOverride(t *testing.T) {
+	key := testAppKey(t)
+	srv, calls := fakeGitHubAPI(t, key, http.StatusOK, http.StatusCreated)
+	appTokenConfig(t, srv.URL)
+	if err := os.MkdirAll(filepath.Dir(projectConfigPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	config := `{"publish": {"git": {"repo": "https://github.com/example/elsewhere.git"}}}`
+	if err := os.WriteFile(projectConfigPath, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PUBLISH_GIT_REPO", "https://github.com/henryhall897/homelabwiki.git")
+
+	if err := (Publish{}).AppToken(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(*calls, ","); !strings.HasPrefix(got, "GET /repos/henryhall897/homelabwiki/installation,") {
+		t.Errorf("calls = %s, want the installation of the PUBLISH_GIT_REPO repository", got)
+	}
+}
@@ -0,0 +1,364 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// publishManifestName is the file in the target directory listing every image
+// this repo has published there. Only images listed in it are ever deleted, so
+// images added to the wiki by other means are left alone.
+const publishManifestName = ".wiki-diagrams-manifest"
+
+// gitSyncResult lists the diagram files a sync added, changed or removed.
+// ManifestChanged is set when only the manifest needs committing, e.g. on the
+// first publish into a directory that already holds identical images.
+type gitSyncResult struct {
+	Added           []string
+	Updated         []string
+	Removed         []string
+	ManifestChanged bool
+}
+
+func (r gitSyncResult) empty() bool {
+	return len(r.Added)+len(r.Updated)+len(r.Removed) == 0 && !r.ManifestChanged
+}
+
+// Git publishes the rendered diagrams to the wiki repository: it clones or
+// updates the target repo, mirrors gen/png into it (deleting only images it
+// published earlier, as recorded in the publish manifest), commits with a
+// message listing the changed diagrams, and pushes.
+//
+// Set PUBLISH_DRY_RUN=1 to print the plan without touching the target repo:
+// the plan is computed against a throwaway clone, so the working copy is left
+// as it is. PUBLISH_GIT_TOKEN, when set, authenticates HTTPS fetches and
+// pushes; otherwise a GitHub App installation token is minted when an app id
+// is configured, except on dry runs.
+func (Publish) Git() error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	g, err := resolveGitPublishConfig(cfg)
+	if err != nil {
+		return err
+	}
+	dryRun := envBool("PUBLISH_DRY_RUN")
+
+	fmt.Printf("📚 Publishing diagrams to %s (branch %s, path %s)\n", g.Repo, g.Branch, g.Path)
+	if dryRun {
+		fmt.Println("🧪 Dry run — no files will be written, committed or pushed.")
+	}
+
+	token := os.Getenv("PUBLISH_GIT_TOKEN")
+	if token == "" && !dryRun && (cfg.Publish.GitHubApp.AppID != "" || os.Getenv("WIKI_DIAGRAM_APP_ID") != "") {
+		tok, err := mintGitHubAppToken(cfg.Publish.GitHubApp, g.Repo)
+		if err != nil {
+			return err
+		}
+		token = tok.Token
+	}
+
+	if dryRun {
+		// checkout resets and cleans the working copy, so plan in a scratch clone.
+		scratch, err := os.MkdirTemp("", "wiki-diagrams-publish-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(scratch)
+		g.Workdir = scratch
+	}
+
+	pub := gitPublisher{cfg: g, token: token}
+	if err := pub.checkout(); err != nil {
+		return err
+	}
+
+	result, err := syncDiagrams(genPNGDir, filepath.Join(g.Workdir, g.Path), dryRun)
+	if err != nil {
+		return err
+	}
+	if result.empty() {
+		fmt.Println("✅ Wiki repository already up to date — nothing to publish.")
+		return nil
+	}
+
+	message := publishCommitMessage(result)
+	fmt.Printf("📝 Commit message:\n%s\n", indent(message, "   "))
+	if dryRun {
+		return nil
+	}
+
+	if err := pub.commitAndPush(message); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Published %d diagram changes to %s.\n",
+		len(result.Added)+len(result.Updated)+len(result.Removed), g.Repo)
+	return nil
+}
+
+// resolveGitPublishConfig applies the PUBLISH_GIT_REPO and PUBLISH_GIT_BRANCH
+// overrides to the configured publish target.
+func resolveGitPublishConfig(cfg projectConfig) (gitPublishConfig, error) {
+	g := cfg.Publish.Git
+	if env := os.Getenv("PUBLISH_GIT_REPO"); env != "" {
+		g.Repo = env
+	}
+	if env := os.Getenv("PUBLISH_GIT_BRANCH"); env != "" {
+		g.Branch = env
+	}
+	if _, err := os.Stat(g.Repo); err == nil {
+		// Local repositories are resolved before git runs inside the working copy.
+		if g.Repo, err = filepath.Abs(g.Repo); err != nil {
+			return g, err
+		}
+	}
+	return g, nil
+}
+
+// gitPublisher runs git against the publish working copy.
+type gitPublisher struct {
+	cfg   gitPublishConfig
+	token string
+}
+
+// checkout clones the target repo into the working copy, or resets an
+// existing working copy to the remote branch.
+func (p gitPublisher) checkout() error {
+	dir := p.cfg.Workdir
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		fmt.Printf("📥 Initialising working copy in %s\n", dir)
+		if err := ensureDir(dir); err != nil {
+			return err
+		}
+		if _, err := p.git("init", "-q"); err != nil {
+			return err
+		}
+		if _, err := p.git("remote", "add", "origin", p.cfg.Repo); err != nil {
+			return err
+		}
+	} else if _, err := p.git("remote", "set-url", "origin", p.cfg.Repo); err != nil {
+		return err
+	}
+
+	heads, err := p.git("ls-remote", "--heads", "origin", p.cfg.Branch)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(heads) == "" {
+		// Empty remote or new branch: start from an unborn branch.
+		fmt.Printf("🌱 Branch %s does not exist on the remote yet; it will be created.\n", p.cfg.Branch)
+		_, err := p.git("symbolic-ref", "HEAD", "refs/heads/"+p.cfg.Branch)
+		return err
+	}
+
+	fmt.Printf("🔄 Updating working copy from origin/%s\n", p.cfg.Branch)
+	steps := [][]string{
+		{"fetch", "-q", "--depth", "1", "origin", p.cfg.Branch},
+		{"checkout", "-q", "-B", p.cfg.Branch, "FETCH_HEAD"},
+		{"reset", "-q", "--hard", "FETCH_HEAD"},
+		{"clean", "-q", "-fd"},
+	}
+	for _, args := range steps {
+		if _, err := p.git(args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// commitAndPush commits the synced path and pushes it to the target branch.
+func (p gitPublisher) commitAndPush(message string) error {
+	if _, err := p.git("add", "-A", "--", p.cfg.Path); err != nil {
+		return err
+	}
+	if _, err := p.git(
+		"-c", "user.name="+p.cfg.AuthorName,
+		"-c", "user.email="+p.cfg.AuthorEmail,
+		"commit", "-q", "-m", message,
+	); err != nil {
+		return err
+	}
+	fmt.Printf("⬆️  Pushing to origin/%s...\n", p.cfg.Branch)
+	_, err := p.git("push", "-q", "origin", "HEAD:refs/heads/"+p.cfg.Branch)
+	return err
+}
+
+// git runs a git command in the working copy. The token is passed as an
+// extra HTTP header so it never lands in .git/config or in remote URLs.
+func (p gitPublisher) git(args ...string) (string, error) {
+	if p.token != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + p.token))
+		args = append([]string{"-c", "http.extraHeader=Authorization: Basic " + auth}, args...)
+	}
+
+	var out bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = p.cfg.Workdir
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		name := args[0]
+		if name == "-c" {
+			name = args[2]
+		}
+		return "", fmt.Errorf("git %s failed: %w\n%s", name, err, strings.TrimSpace(out.String()))
+	}
+	return out.String(), nil
+}
+
+// syncDiagrams mirrors the rendered images in srcDir into dstDir. Images
+// listed in dstDir's publish manifest that no longer have a source are
+// removed; other images in dstDir are never touched. The manifest is then
+// rewritten to list the current sources. With dryRun set nothing is written.
+func syncDiagrams(srcDir, dstDir string, dryRun bool) (gitSyncResult, error) {
+	var result gitSyncResult
+
+	sources, err := filepath.Glob(filepath.Join(srcDir, "*."+outputExt))
+	if err != nil {
+		return result, err
+	}
+	if len(sources) == 0 {
+		return result, fmt.Errorf("no rendered diagrams found in %s — run mage diagrams:renderAll first", srcDir)
+	}
+	if !dryRun {
+		if err := ensureDir(dstDir); err != nil {
+			return result, err
+		}
+	}
+
+	keep := make(map[string]bool, len(sources))
+	for _, src := range sources {
+		name := filepath.Base(src)
+		keep[name] = true
+
+		data, err := os.ReadFile(src)
+		if err != nil {
+			return result, err
+		}
+		dst := filepath.Join(dstDir, name)
+		existing, err := os.ReadFile(dst)
+		switch {
+		case os.IsNotExist(err):
+			result.Added = append(result.Added, name)
+		case err != nil:
+			return result, err
+		case bytes.Equal(existing, data):
+			continue
+		default:
+			result.Updated = append(result.Updated, name)
+		}
+		if !dryRun {
+			if err := os.WriteFile(dst, data, 0644); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	manifestPath := filepath.Join(dstDir, publishManifestName)
+	published, err := readPublishManifest(manifestPath)
+	if err != nil {
+		return result, err
+	}
+	for _, name := range published {
+		if keep[name] {
+			continue
+		}
+		dst := filepath.Join(dstDir, name)
+		if _, err := os.Stat(dst); os.IsNotExist(err) {
+			continue
+		}
+		result.Removed = append(result.Removed, name)
+		if !dryRun {
+			if err := os.Remove(dst); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	names := make([]string, 0, len(keep))
+	for name := range keep {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	manifest := strings.Join(names, "\n") + "\n"
+	if existing, err := os.ReadFile(manifestPath); err != nil || string(existing) != manifest {
+		result.ManifestChanged = true
+		if !dryRun {
+			if err := os.WriteFile(manifestPath, []byte(manifest), 0644); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	for _, list := range [][]string{result.Added, result.Updated, result.Removed} {
+		sort.Strings(list)
+	}
+	return result, nil
+}
+
+// readPublishManifest returns the file names recorded in a publish manifest,
+// or none when it does not exist yet.
+func readPublishManifest(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, line := range strings.Split(string(data), "\n") {
+		name := strings.TrimSpace(line)
+		// Entries are bare file names; anything else is not ours to delete.
+		if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+			continue
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// publishCommitMessage builds a commit message listing every changed diagram.
+func publishCommitMessage(r gitSyncResult) string {
+	var b strings.Builder
+	b.WriteString("📦 Update diagrams from wiki-diagrams [automated]\n")
+	for _, section := range []struct {
+		title string
+		files []string
+	}{{"Added", r.Added}, {"Updated", r.Updated}, {"Removed", r.Removed}} {
+		if len(section.files) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s:\n", section.title)
+		for _, f := range section.files {
+			fmt.Fprintf(&b, "- %s\n", f)
+		}
+	}
+	if len(r.Added)+len(r.Updated)+len(r.Removed) == 0 && r.ManifestChanged {
+		fmt.Fprintf(&b, "\nRecorded the published images in %s.\n", publishManifestName)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// indent prefixes every line of s.
+func indent(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
+
+// envBool reports whether an environment variable is set to a truthy value.
+func envBool(name string) bool {
+	switch strings.ToLower(os.Getenv(name)) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
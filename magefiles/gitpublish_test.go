@@ -0,0 +1,222 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// publishFixture is a scratch project publishing into a local bare repository.
+type publishFixture struct {
+	t    *testing.T
+	bare string
+}
+
+// newPublishFixture switches into an empty project directory whose publish
+// target is a fresh bare repository, seeded with an image this project never
+// published.
+func newPublishFixture(t *testing.T) *publishFixture {
+	t.Helper()
+	root := t.TempDir()
+	t.Chdir(root)
+	t.Setenv("PUBLISH_DRY_RUN", "")
+	t.Setenv("PUBLISH_GIT_TOKEN", "")
+	t.Setenv("WIKI_DIAGRAM_APP_ID", "")
+	t.Setenv("PUBLISH_GIT_BRANCH", "")
+
+	f := &publishFixture{t: t, bare: filepath.Join(root, "wiki.git")}
+	f.run("", "init", "-q", "--bare", f.bare)
+	t.Setenv("PUBLISH_GIT_REPO", f.bare)
+
+	seed := filepath.Join(root, "seed")
+	f.run("", "clone", "-q", f.bare, seed)
+	f.write(filepath.Join(seed, "assets/diagrams/hand-drawn.png"), "not ours")
+	f.run(seed, "add", "-A")
+	f.run(seed, "-c", "user.name=t", "-c", "user.email=t@example.com", "commit", "-q", "-m", "seed")
+	f.run(seed, "push", "-q", "origin", "HEAD:refs/heads/main")
+	return f
+}
+
+func (f *publishFixture) run(dir string, args ...string) string {
+	f.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		f.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (f *publishFixture) write(path, content string) {
+	f.t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		f.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+// render stands in for a render by writing an image into gen/png.
+func (f *publishFixture) render(name, content string) {
+	f.write(filepath.Join(genPNGDir, name), content)
+}
+
+func (f *publishFixture) publish() {
+	f.t.Helper()
+	if err := (Publish{}).Git(); err != nil {
+		f.t.Fatalf("Publish.Git: %v", err)
+	}
+}
+
+func (f *publishFixture) commits() int {
+	return len(strings.Split(f.run("", "--git-dir", f.bare, "log", "--format=%H", "main"), "\n"))
+}
+
+func (f *publishFixture) lastMessage() string {
+	return f.run("", "--git-dir", f.bare, "log", "-1", "--format=%B", "main")
+}
+
+func (f *publishFixture) published(name string) (string, bool) {
+	cmd := exec.Command("git", "--git-dir", f.bare, "show", "main:assets/diagrams/"+name)
+	out, err := cmd.Output()
+	return string(out), err == nil
+}
+
+func TestPublishGitAgainstBareRepository(t *testing.T) {
+	f := newPublishFixture(t)
+
+	// Add
+	f.render("a.png", "a1")
+	f.render("b.png", "b1")
+	f.publish()
+	if got, want := f.lastMessage(), "📦 Update diagrams from wiki-diagrams [automated]\n\nAdded:\n- a.png\n- b.png"; got != want {
+		t.Errorf("add commit message = %q, want %q", got, want)
+	}
+	if got, _ := f.published("a.png"); got != "a1" {
+		t.Errorf("a.png = %q after add, want a1", got)
+	}
+	if got, _ := f.published(publishManifestName); got != "a.png\nb.png\n" {
+		t.Errorf("manifest = %q after add", got)
+	}
+
+	// Update
+	f.render("a.png", "a2")
+	f.publish()
+	if got, want := f.lastMessage(), "📦 Update diagrams from wiki-diagrams [automated]\n\nUpdated:\n- a.png"; got != want {
+		t.Errorf("update commit message = %q, want %q", got, want)
+	}
+	if got, _ := f.published("a.png"); got != "a2" {
+		t.Errorf("a.png = %q after update, want a2", got)
+	}
+
+	// Delete: only images recorded in the manifest are removed.
+	if err := os.Remove(filepath.Join(genPNGDir, "b.png")); err != nil {
+		t.Fatal(err)
+	}
+	f.publish()
+	if got, want := f.lastMessage(), "📦 Update diagrams from wiki-diagrams [automated]\n\nRemoved:\n- b.png"; got != want {
+		t.Errorf("delete commit message = %q, want %q", got, want)
+	}
+	if _, ok := f.published("b.png"); ok {
+		t.Error("b.png still published after deleting its source")
+	}
+	if _, ok := f.published("hand-drawn.png"); !ok {
+		t.Error("hand-drawn.png, never published by this repo, was deleted")
+	}
+
+	// No-op
+	before := f.commits()
+	f.publish()
+	if got := f.commits(); got != before {
+		t.Errorf("no-op publish made %d new commits", got-before)
+	}
+
+	// Dry run: the working copy keeps local edits and no app token is minted,
+	// which would fail here against an unreachable API.
+	f.render("a.png", "a3")
+	f.render("c.png", "c1")
+	workCopy := filepath.Join(defaultPublishWorkdir(t), "assets/diagrams")
+	f.write(filepath.Join(workCopy, "a.png"), "local edit")
+	f.write(filepath.Join(workCopy, "untracked.png"), "untracked")
+	t.Setenv("PUBLISH_DRY_RUN", "1")
+	t.Setenv("WIKI_DIAGRAM_APP_ID", "12345")
+	t.Setenv("GITHUB_API_URL", "http://127.0.0.1:1")
+	f.publish()
+	if got := f.commits(); got != before {
+		t.Errorf("dry run made %d new commits", got-before)
+	}
+	if got, _ := f.published("a.png"); got != "a2" {
+		t.Errorf("a.png = %q after dry run, want a2", got)
+	}
+	if _, err := os.Stat(filepath.Join(workCopy, "c.png")); !os.IsNotExist(err) {
+		t.Errorf("dry run wrote c.png into the working copy (stat err %v)", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(workCopy, "a.png")); err != nil || string(got) != "local edit" {
+		t.Errorf("dry run reset a.png in the working copy to %q (err %v)", got, err)
+	}
+	if _, err := os.Stat(filepath.Join(workCopy, "untracked.png")); err != nil {
+		t.Errorf("dry run cleaned untracked.png from the working copy: %v", err)
+	}
+}
+
+// defaultPublishWorkdir is the working copy used when diagrams.json is absent.
+func defaultPublishWorkdir(t *testing.T) string {
+	t.Helper()
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Publish.Git.Workdir
+}
+
+func TestSyncDiagramsAdoptsExistingImages(t *testing.T) {
+	src, dst := t.TempDir(), t.TempDir()
+	for _, dir := range []string{src, dst} {
+		if err := os.WriteFile(filepath.Join(dir, "a.png"), []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := syncDiagrams(src, dst, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.empty() || !result.ManifestChanged {
+		t.Fatalf("first sync into a directory without a manifest = %+v, want a manifest change", result)
+	}
+	if got, want := publishCommitMessage(result), "📦 Update diagrams from wiki-diagrams [automated]\n\nRecorded the published images in "+publishManifestName+"."; got != want {
+		t.Errorf("commit message = %q, want %q", got, want)
+	}
+
+	if result, err = syncDiagrams(src, dst, false); err != nil || !result.empty() {
+		t.Errorf("second sync = %+v, %v; want no changes", result, err)
+	}
+}
+
+func TestPublishCommitMessage(t *testing.T) {
+	got := publishCommitMessage(gitSyncResult{
+		Added:   []string{"new.png"},
+		Updated: []string{"a.png", "b.png"},
+		Removed: []string{"old.png"},
+	})
+	want := `📦 Update diagrams from wiki-diagrams [automated]
+
+Added:
+- new.png
+
+Updated:
+- a.png
+- b.png
+
+Removed:
+- old.png`
+	if got != want {
+		t.Errorf("publishCommitMessage = %q, want %q", got, want)
+	}
+}
@@ -3,10 +3,20 @@
 package main
 
 import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/magefile/mage/mg"
 	"github.com/magefile/mage/sh"
@@ -15,6 +25,13 @@ import (
 // TargetGoVersion defines the pinned Go version used for reproducible builds.
 const TargetGoVersion = "1.25.3"
 
+// Go version constraints: toolchains outside GoVersionRequired fail
+// verification; those outside GoVersionRecommended only print a note.
+const (
+	GoVersionRequired    = ">=1.25.0 <1.26"
+	GoVersionRecommended = "=" + TargetGoVersion
+)
+
 // Go namespace groups all Go-related tasks.
 type Go mg.Namespace
 
@@ -38,12 +55,14 @@ func (Go) Deps() error {
 	}
 
 	fmt.Printf("Installing Go %s...\n", TargetGoVersion)
-	if err := installGoVersion(TargetGoVersion); err != nil {
+	goBin, err := installGoVersion(TargetGoVersion)
+	if err != nil {
 		return fmt.Errorf("failed to install Go %s: %w", TargetGoVersion, err)
 	}
 
+	// Verify the toolchain just installed, not whichever go is first in PATH.
 	fmt.Println("Re-verifying Go installation...")
-	if err := (Go{}).Verify(); err != nil {
+	if err := verifyGoBinary(goBin); err != nil {
 		return fmt.Errorf("Go installation did not verify successfully: %w", err)
 	}
 
@@ -51,13 +70,21 @@ func (Go) Deps() error {
 	return nil
 }
 
-// verifyGoVersion checks that the installed Go version matches the target version.
+// verifyGoVersion checks that the Go in PATH satisfies the version constraints.
 func verifyGoVersion() error {
-	fmt.Printf("Target Go version: %s\n", TargetGoVersion)
+	return verifyGoBinary("go")
+}
 
-	out, err := exec.Command("go", "version").Output()
+// verifyGoBinary checks that the given go binary satisfies the version constraints.
+func verifyGoBinary(goBin string) error {
+	fmt.Printf("Target Go version: %s (required %s)\n", TargetGoVersion, GoVersionRequired)
+
+	out, err := exec.Command(goBin, "version").Output()
 	if err != nil {
-		return fmt.Errorf("go binary not found in PATH")
+		if goBin == "go" {
+			return fmt.Errorf("go binary not found in PATH")
+		}
+		return fmt.Errorf("failed to run %s version: %w", goBin, err)
 	}
 
 	fields := strings.Fields(string(out))
@@ -65,9 +92,8 @@ func verifyGoVersion() error {
 		return fmt.Errorf("unexpected output from 'go version': %s", string(out))
 	}
 
-	current := strings.TrimPrefix(fields[2], "go")
-	if current != TargetGoVersion {
-		return fmt.Errorf("Go version mismatch: found %s, expected %s", current, TargetGoVersion)
+	if _, err := checkToolVersion("Go", fields[2], GoVersionRequired, GoVersionRecommended); err != nil {
+		return err
 	}
 
 	// Inform the user if their pinned version is outdated
@@ -78,19 +104,34 @@ func verifyGoVersion() error {
 // checkGoVersionLatest queries the official Go site for the latest release
 // and warns if the pinned version is behind. If the system is offline or the
 // version check cannot be completed, it prints a notice and continues silently.
+// Set GO_SKIP_LATEST_CHECK=1 to skip it; GO_LATEST_TIMEOUT (default 5s) bounds it.
 func checkGoVersionLatest() {
-	out, err := exec.Command("curl", "-s", "https://go.dev/VERSION?m=text").Output()
+	if envBool("GO_SKIP_LATEST_CHECK") {
+		return
+	}
+
+	timeout := 5 * time.Second
+	if env := os.Getenv("GO_LATEST_TIMEOUT"); env != "" {
+		if d, err := time.ParseDuration(env); err == nil {
+			timeout = d
+		}
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get("https://go.dev/VERSION?m=text")
 	if err != nil {
 		fmt.Println("Skipping Go version update check (network unavailable or offline).")
 		return
 	}
+	defer resp.Body.Close()
 
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	if len(lines) == 0 {
+	out, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil || resp.StatusCode != http.StatusOK {
 		fmt.Println("Unable to parse Go version information from remote source.")
 		return
 	}
 
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
 	latest := strings.TrimPrefix(strings.TrimSpace(lines[0]), "go")
 	if latest == "" {
 		fmt.Println("Unable to parse Go version information from remote source.")
@@ -102,8 +143,16 @@ func checkGoVersionLatest() {
 	}
 }
 
-// installGoVersion downloads and installs the specified Go version, verifying its checksum if available.
-func installGoVersion(version string) error {
+// goChecksumsPath is the committed table of official Go archive checksums.
+const goChecksumsPath = "magefiles/go.sha256"
+
+// installGoVersion installs the specified Go version from a local tarball
+// (GO_TARBALL) or a download mirror (GO_MIRROR, default https://go.dev/dl).
+// The archive's SHA-256 must match the committed checksum table. It installs
+// into GO_INSTALL_DIR (default /usr/local/go), using sudo only when that
+// directory's parent is not writable by the current user. It returns the
+// path of the installed go binary.
+func installGoVersion(version string) (string, error) {
 	osName := runtime.GOOS
 	arch := runtime.GOARCH
 
@@ -114,7 +163,7 @@ func installGoVersion(version string) error {
 	case "darwin":
 		goOS = "darwin"
 	default:
-		return fmt.Errorf("unsupported OS: %s", osName)
+		return "", fmt.Errorf("unsupported OS: %s", osName)
 	}
 
 	switch arch {
@@ -123,44 +172,331 @@ func installGoVersion(version string) error {
 	case "arm64":
 		goArch = "arm64"
 	default:
-		return fmt.Errorf("unsupported architecture: %s", arch)
+		return "", fmt.Errorf("unsupported architecture: %s", arch)
+	}
+
+	installDir := os.Getenv("GO_INSTALL_DIR")
+	if installDir == "" {
+		installDir = "/usr/local/go"
+	}
+	installDir = expandHome(installDir)
+	if err := checkGoInstallDir(installDir); err != nil {
+		return "", err
+	}
+
+	archive := fmt.Sprintf("go%s.%s-%s.tar.gz", version, goOS, goArch)
+	expected, err := lookupGoChecksum(archive)
+	if err != nil {
+		return "", err
+	}
+
+	tarball := os.Getenv("GO_TARBALL")
+	if tarball == "" {
+		mirror := strings.TrimSuffix(os.Getenv("GO_MIRROR"), "/")
+		if mirror == "" {
+			mirror = "https://go.dev/dl"
+		}
+		tarball = filepath.Join(os.TempDir(), archive)
+		fmt.Printf("Downloading Go %s for %s/%s from %s...\n", version, goOS, goArch, mirror)
+		if err := downloadFile(mirror+"/"+archive, tarball); err != nil {
+			return "", fmt.Errorf("failed to download Go: %w", err)
+		}
+	} else {
+		fmt.Printf("Using local Go archive %s...\n", tarball)
+	}
+
+	fmt.Println("Verifying checksum against", goChecksumsPath+"...")
+	if err := verifySHA256(tarball, expected); err != nil {
+		return "", err
+	}
+
+	if dirWritable(filepath.Dir(installDir)) {
+		fmt.Printf("Extracting Go to %s...\n", installDir)
+		if err := os.RemoveAll(installDir); err != nil {
+			return "", err
+		}
+		if err := extractGoTarball(tarball, installDir); err != nil {
+			return "", err
+		}
+	} else {
+		fmt.Printf("Extracting Go to %s (requires sudo)...\n", installDir)
+		if err := sh.RunV("sudo", "rm", "-rf", installDir); err != nil {
+			return "", err
+		}
+		if err := sh.RunV("sudo", "mkdir", "-p", installDir); err != nil {
+			return "", err
+		}
+		if err := sh.RunV("sudo", "tar", "-C", installDir, "--strip-components=1", "-xzf", tarball); err != nil {
+			return "", err
+		}
+	}
+
+	goBin := filepath.Join(installDir, "bin", "go")
+	fmt.Println("Verifying installation...")
+	if err := sh.RunV(goBin, "version"); err != nil {
+		return "", err
+	}
+
+	// Check PATH visibility
+	if path, err := exec.LookPath("go"); err != nil || path != goBin {
+		fmt.Printf("Note: %s may not be first in your PATH. You may need to update your shell configuration.\n", filepath.Dir(goBin))
+	}
+
+	return goBin, nil
+}
+
+// goChecksumPlatforms are the archives recorded in the checksum table.
+var goChecksumPlatforms = []string{"linux-amd64", "linux-arm64", "darwin-amd64", "darwin-arm64"}
+
+// Checksums fetches the official SHA-256 of the TargetGoVersion archives from
+// go.dev (GO_DL_INDEX overrides the index URL) and rewrites the committed
+// checksum table. Run it when bumping TargetGoVersion and commit the result.
+func (Go) Checksums() error {
+	index := os.Getenv("GO_DL_INDEX")
+	if index == "" {
+		index = "https://go.dev/dl/?mode=json&include=all"
+	}
+	fmt.Printf("Fetching Go release index from %s...\n", index)
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(index)
+	if err != nil {
+		return fmt.Errorf("failed to fetch Go release index: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", index, resp.Status)
+	}
+
+	var releases []struct {
+		Version string `json:"version"`
+		Files   []struct {
+			Filename string `json:"filename"`
+			SHA256   string `json:"sha256"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return fmt.Errorf("failed to parse Go release index: %w", err)
+	}
+
+	sums := map[string]string{}
+	for _, rel := range releases {
+		if rel.Version != "go"+TargetGoVersion {
+			continue
+		}
+		for _, f := range rel.Files {
+			sums[f.Filename] = f.SHA256
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString(goChecksumsHeader)
+	for _, platform := range goChecksumPlatforms {
+		archive := fmt.Sprintf("go%s.%s.tar.gz", TargetGoVersion, platform)
+		sum, ok := sums[archive]
+		if !ok {
+			return fmt.Errorf("%s is not listed in the Go release index", archive)
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, archive)
+		fmt.Printf("   %s  %s\n", sum, archive)
 	}
+	if err := os.WriteFile(goChecksumsPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	fmt.Println("✅ Updated", goChecksumsPath)
+	return nil
+}
 
-	url := fmt.Sprintf("https://go.dev/dl/go%s.%s-%s.tar.gz", version, goOS, goArch)
-	tmpFile := fmt.Sprintf("/tmp/go%s.%s-%s.tar.gz", version, goOS, goArch)
+// goChecksumsHeader is written at the top of the checksum table.
+const goChecksumsHeader = `# SHA-256 checksums of official Go release archives, copied from https://go.dev/dl/.
+# installGoVersion verifies every archive (downloaded or GO_TARBALL) against this
+# table and refuses to install archives that are not listed here.
+# Regenerate with: mage go:checksums
+# Format: <sha256>  <archive>
+`
 
-	fmt.Printf("Downloading Go %s for %s/%s...\n", version, goOS, goArch)
-	if err := sh.RunV("curl", "-L", "-o", tmpFile, url); err != nil {
-		return fmt.Errorf("failed to download Go: %w", err)
+// lookupGoChecksum returns the committed SHA-256 for a Go release archive.
+func lookupGoChecksum(archive string) (string, error) {
+	sums, err := readChecksumTable(goChecksumsPath)
+	if err != nil {
+		return "", err
+	}
+	if sum, ok := sums[archive]; ok {
+		return sum, nil
 	}
+	return "", fmt.Errorf("no checksum for %s in %s — run mage go:checksums on a networked machine and commit the result", archive, goChecksumsPath)
+}
 
-	// Attempt checksum verification if available
-	checksumURL := url + ".sha256"
-	checksumFile := tmpFile + ".sha256"
-	if err := sh.RunV("curl", "-s", "-L", "-o", checksumFile, checksumURL); err == nil {
-		fmt.Println("Verifying checksum...")
-		if err := sh.RunV("sha256sum", "-c", checksumFile); err != nil {
-			return fmt.Errorf("checksum verification failed: %w", err)
+// readChecksumTable parses a sha256sum-style file ("<sha256>  <name>" per
+// line, # comments) into a map from name to lower-case digest.
+func readChecksumTable(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksum table: %w", err)
+	}
+	sums := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && !strings.HasPrefix(fields[0], "#") {
+			sums[fields[1]] = strings.ToLower(fields[0])
 		}
 	}
+	return sums, nil
+}
 
-	fmt.Println("Extracting Go to /usr/local/go (requires sudo)...")
-	if err := sh.RunV("sudo", "rm", "-rf", "/usr/local/go"); err != nil {
+// verifySHA256 compares a file's SHA-256 with the expected hex digest.
+func verifySHA256(path, expected string) error {
+	got, err := fileSHA256(path)
+	if err != nil {
 		return err
 	}
-	if err := sh.RunV("sudo", "tar", "-C", "/usr/local", "-xzf", tmpFile); err != nil {
+	if got != expected {
+		return fmt.Errorf("checksum mismatch for %s: got %s, expected %s", filepath.Base(path), got, expected)
+	}
+	return nil
+}
+
+// fileSHA256 returns the hex SHA-256 of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// downloadFile fetches url into path.
+func downloadFile(url, path string) error {
+	resp, err := http.Get(url)
+	if err != nil {
 		return err
 	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
 
-	fmt.Println("Verifying installation...")
-	if err := sh.RunV("/usr/local/go/bin/go", "version"); err != nil {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
 		return err
 	}
+	return f.Close()
+}
 
-	// Check PATH visibility
-	if _, err := exec.LookPath("go"); err != nil {
-		fmt.Println("Note: /usr/local/go/bin may not be in your PATH. You may need to update your shell configuration.")
+// extractGoTarball unpacks a Go release archive into dest, dropping the
+// archive's leading "go/" directory.
+func extractGoTarball(tarball, dest string) error {
+	f, err := os.Open(tarball)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
 	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		_, rel, _ := strings.Cut(hdr.Name, "/")
+		if rel == "" {
+			continue
+		}
+		target := filepath.Join(dest, rel)
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %s escapes %s", hdr.Name, dest)
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, tr); err != nil {
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
 
+// checkGoInstallDir refuses to let the install replace a directory that is not
+// a Go tree: it must be missing, empty, or contain bin/go and VERSION.
+func checkGoInstallDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot inspect GO_INSTALL_DIR %s: %w", dir, err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, marker := range []string{filepath.Join("bin", "go"), "VERSION"} {
+		if _, err := os.Stat(filepath.Join(dir, marker)); err != nil {
+			return fmt.Errorf("refusing to replace %s: it is not empty and has no %s, so it does not look like a Go installation — point GO_INSTALL_DIR at a Go root or an empty directory", dir, marker)
+		}
+	}
 	return nil
 }
+
+// dirWritable reports whether the current user can create files in dir, or
+// in its nearest existing ancestor when dir does not exist yet. It never
+// creates directories.
+func dirWritable(dir string) bool {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return false
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return false
+		}
+		dir = parent
+	}
+	f, err := os.CreateTemp(dir, ".write-test-*")
+	if err != nil {
+		return false
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
@@ -0,0 +1,227 @@
+//go:build mage
+
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// tarEntry is one file in a generated test archive; an empty body with
+// link set makes a symlink, a trailing "/" a directory.
+type tarEntry struct {
+	name, body, link string
+	mode             int64
+}
+
+// writeTestTarball writes a gzip-compressed tar archive of entries.
+func writeTestTarball(t *testing.T, path string, entries []tarEntry) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: e.mode, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		switch {
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname = tar.TypeSymlink, e.link
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeGoTree is a minimal Go release layout whose go binary is a shell script.
+func fakeGoTree(version string) []tarEntry {
+	return []tarEntry{
+		{name: "go/"},
+		{name: "go/VERSION", body: "go" + version + "\n", mode: 0644},
+		{name: "go/bin/go", body: fmt.Sprintf("#!/bin/sh\necho go version go%s %s/%s\n", version, runtime.GOOS, runtime.GOARCH), mode: 0755},
+		{name: "go/bin/gofmt-link", link: "go"},
+	}
+}
+
+func TestReadChecksumTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sums")
+	content := "# comment line\n\nABCDEF0123  go1.25.3.linux-amd64.tar.gz\n" +
+		"0123abcd  go1.25.3.darwin-arm64.tar.gz\nmalformed\ntoo many fields here\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sums, err := readChecksumTable(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"go1.25.3.linux-amd64.tar.gz": "abcdef0123", "go1.25.3.darwin-arm64.tar.gz": "0123abcd"}
+	if len(sums) != len(want) {
+		t.Errorf("sums = %v, want %v", sums, want)
+	}
+	for name, sum := range want {
+		if sums[name] != sum {
+			t.Errorf("sums[%s] = %q, want %q", name, sums[name], sum)
+		}
+	}
+
+	if _, err := readChecksumTable(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing checksum table did not fail")
+	}
+}
+
+func TestVerifySHA256(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data")
+	if err := os.WriteFile(path, []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	const helloSum = "5891b5b522d5df086d0ff0b110fbd9d21bb4fc7163af34d08286a2e846f6be03"
+	if err := verifySHA256(path, helloSum); err != nil {
+		t.Errorf("matching checksum rejected: %v", err)
+	}
+	if err := verifySHA256(path, strings.Repeat("0", 64)); err == nil || !strings.Contains(err.Error(), "checksum mismatch for data") {
+		t.Errorf("mismatch error = %v", err)
+	}
+}
+
+func TestExtractGoTarball(t *testing.T) {
+	dir := t.TempDir()
+	tarball := filepath.Join(dir, "go.tar.gz")
+	writeTestTarball(t, tarball, fakeGoTree("1.25.3"))
+
+	dest := filepath.Join(dir, "goroot")
+	if err := extractGoTarball(tarball, dest); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dest, "bin", "go"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("bin/go = %v, %v; want an executable file", info, err)
+	}
+	if link, err := os.Readlink(filepath.Join(dest, "bin", "gofmt-link")); err != nil || link != "go" {
+		t.Errorf("symlink = %q, %v", link, err)
+	}
+
+	for _, name := range []string{"go/../../escaped", "go/bin/../../../escaped"} {
+		evil := filepath.Join(dir, "evil.tar.gz")
+		writeTestTarball(t, evil, []tarEntry{{name: "go/"}, {name: name, body: "pwned", mode: 0644}})
+		err := extractGoTarball(evil, filepath.Join(dir, "evil-root"))
+		if err == nil || !strings.Contains(err.Error(), "escapes") {
+			t.Errorf("%s: error = %v, want an escape error", name, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "escaped")); err == nil {
+			t.Errorf("%s was written outside the destination", name)
+		}
+	}
+}
+
+func TestCheckGoInstallDir(t *testing.T) {
+	root := t.TempDir()
+	goTree := filepath.Join(root, "go")
+	if err := installFakeGoTree(t, goTree); err != nil {
+		t.Fatal(err)
+	}
+	empty := filepath.Join(root, "empty")
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	home := filepath.Join(root, "home")
+	if err := os.MkdirAll(filepath.Join(home, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, "notes.txt"), []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for dir, ok := range map[string]bool{filepath.Join(root, "missing"): true, empty: true, goTree: true, home: false} {
+		err := checkGoInstallDir(dir)
+		if ok && err != nil {
+			t.Errorf("%s rejected: %v", dir, err)
+		}
+		if !ok && (err == nil || !strings.Contains(err.Error(), "refusing to replace")) {
+			t.Errorf("%s accepted (err %v), want a refusal", dir, err)
+		}
+	}
+}
+
+// installFakeGoTree extracts a fake Go tree into dest.
+func installFakeGoTree(t *testing.T, dest string) error {
+	tarball := filepath.Join(t.TempDir(), "go.tar.gz")
+	writeTestTarball(t, tarball, fakeGoTree("1.25.3"))
+	return extractGoTarball(tarball, dest)
+}
+
+func TestInstallGoVersionFromLocalTarball(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("Go installs are only supported on linux and darwin")
+	}
+	t.Chdir(t.TempDir())
+	archive := fmt.Sprintf("go%s.%s-%s.tar.gz", TargetGoVersion, runtime.GOOS, runtime.GOARCH)
+	tarball := filepath.Join(t.TempDir(), archive)
+	writeTestTarball(t, tarball, fakeGoTree(TargetGoVersion))
+	sum, err := fileSHA256(tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(goChecksumsPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(goChecksumsPath, []byte(goChecksumsHeader+sum+"  "+archive+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GO_TARBALL", tarball)
+
+	// A directory that is not a Go tree is never removed.
+	notGo := filepath.Join(t.TempDir(), "not-go")
+	if err := os.MkdirAll(notGo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(notGo, "notes.txt"), []byte("keep me"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GO_INSTALL_DIR", notGo)
+	if _, err := installGoVersion(TargetGoVersion); err == nil {
+		t.Fatal("install replaced a directory that is not a Go tree")
+	}
+	if _, err := os.Stat(filepath.Join(notGo, "notes.txt")); err != nil {
+		t.Fatalf("refused install still touched %s: %v", notGo, err)
+	}
+
+	// Reinstalling over an existing Go tree works offline from GO_TARBALL.
+	goRoot := filepath.Join(t.TempDir(), "go")
+	if err := installFakeGoTree(t, goRoot); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GO_INSTALL_DIR", goRoot)
+	goBin, err := installGoVersion(TargetGoVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if goBin != filepath.Join(goRoot, "bin", "go") {
+		t.Errorf("goBin = %s", goBin)
+	}
+
+	// Archives whose checksum differs from the table are refused.
+	writeTestTarball(t, tarball, fakeGoTree("9.9.9"))
+	if _, err := installGoVersion(TargetGoVersion); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("tampered archive: error = %v", err)
+	}
+}
@@ -3,9 +3,11 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
-	"os/exec"
+	"os"
+	"regexp"
 	"strings"
 
 	"github.com/magefile/mage/mg"
@@ -18,6 +20,12 @@ type Mermaid mg.Namespace
 // TargetMermaidVersion defines the pinned version for reproducible builds.
 const TargetMermaidVersion = "10.9.0"
 
+// Mermaid CLI version constraints, see checkToolVersion.
+const (
+	MermaidVersionRequired    = "~10.9"
+	MermaidVersionRecommended = "=" + TargetMermaidVersion
+)
+
 // All runs the full end-to-end pipeline:
 // 1. Ensures all dependencies (system, Go, Git, Mermaid CLI, etc.)
 // 2. Cleans previously generated diagrams
@@ -38,21 +46,28 @@ func (Mermaid) All() error {
 	return nil
 }
 
-// Verify checks that the Mermaid CLI is installed and matches the target version.
+// Verify checks that the Mermaid CLI is installed and satisfies the version constraints.
 func (Mermaid) Verify() error {
 	fmt.Println("Verifying Mermaid CLI installation...")
 
-	out, err := exec.Command("mmdc", "--version").CombinedOutput()
+	cmd, err := mmdcCommand("--version")
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
 	if err != nil {
-		return errors.New("❌ Mermaid CLI not found in PATH. Install it with:\n   npm install -g @mermaid-js/mermaid-cli@" + TargetMermaidVersion)
+		if rendererMode() == rendererContainer {
+			return fmt.Errorf("❌ mmdc failed in renderer image %s. Build it with:\n   mage docker:buildRenderer", rendererImage)
+		}
+		return errors.New("❌ Mermaid CLI not found in " + toolsDir + "/ or PATH. Install it with:\n   mage mermaid:deps")
 	}
 
-	version := strings.TrimSpace(string(out))
-	if !strings.Contains(version, TargetMermaidVersion) {
-		return fmt.Errorf("❌ Mermaid CLI version mismatch: found '%s', expected %s", version, TargetMermaidVersion)
+	version, err := checkToolVersion("Mermaid CLI", string(out), MermaidVersionRequired, MermaidVersionRecommended)
+	if err != nil {
+		return fmt.Errorf("❌ %w", err)
 	}
 
-	fmt.Printf("✅ Mermaid CLI %s verified successfully.\n", TargetMermaidVersion)
+	fmt.Printf("✅ Mermaid CLI %s verified successfully (%s).\n", version, cmd.Path)
 	return nil
 }
 
@@ -60,6 +75,19 @@ func (Mermaid) Verify() error {
 func (Mermaid) Deps() error {
 	fmt.Println("Ensuring Mermaid CLI dependencies...")
 
+	// Container rendering only needs Docker and the renderer image, not host libraries.
+	if rendererMode() == rendererContainer {
+		if err := verifyDockerEngine(); err != nil {
+			return err
+		}
+		if !rendererImageExists() {
+			if err := (Docker{}).BuildRenderer(); err != nil {
+				return err
+			}
+		}
+		return (Mermaid{}).Verify()
+	}
+
 	// Step 1: Verify system libraries for headless Chromium rendering
 	if err := (Mermaid{}).VerifySystemLibs(); err != nil {
 		return fmt.Errorf("system library verification failed: %w", err)
@@ -71,10 +99,9 @@ func (Mermaid) Deps() error {
 		return nil
 	}
 
-	// Step 3: Install Mermaid CLI globally
-	fmt.Printf("Installing Mermaid CLI %s globally via npm...\n", TargetMermaidVersion)
-	if err := sh.RunV("npm", "install", "-g",
-		fmt.Sprintf("@mermaid-js/mermaid-cli@%s", TargetMermaidVersion)); err != nil {
+	// Step 3: Install Mermaid CLI into tools/ from the committed lockfile
+	fmt.Printf("Installing Mermaid CLI %s into %s/ via npm...\n", TargetMermaidVersion, toolsDir)
+	if err := installLocalMermaid(); err != nil {
 		return fmt.Errorf("failed to install Mermaid CLI %s: %w", TargetMermaidVersion, err)
 	}
 
@@ -88,35 +115,149 @@ func (Mermaid) Deps() error {
 	return nil
 }
 
+// Upgrade bumps the pinned Mermaid CLI to version: it updates tools/package.json
+// and the lockfile, then rewrites TargetMermaidVersion in magefiles/mermaid.go.
+// When the new version falls outside MermaidVersionRequired, the constraint is
+// moved to ~MAJOR.MINOR of the new version so Mermaid.Verify accepts it.
+// Commit all three files together.
+func (Mermaid) Upgrade(version string) error {
+	version = strings.TrimPrefix(version, "v")
+	v, _, err := parseSemver(version)
+	if err != nil {
+		return fmt.Errorf("invalid Mermaid CLI version %q: %w", version, err)
+	}
+
+	fmt.Printf("⬆️  Upgrading Mermaid CLI %s → %s...\n", TargetMermaidVersion, version)
+	if err := sh.RunV("npm", "install", "--prefix", toolsDir, "--save-exact",
+		"@mermaid-js/mermaid-cli@"+version); err != nil {
+		return fmt.Errorf("failed to install Mermaid CLI %s: %w", version, err)
+	}
+
+	data, err := os.ReadFile(mermaidGoPath)
+	if err != nil {
+		return err
+	}
+	updated := targetMermaidPattern.ReplaceAll(data, []byte(`${1}"`+version+`"`))
+
+	c, err := parseConstraint(MermaidVersionRequired)
+	if err != nil {
+		return err
+	}
+	if err := c.check(v, "required"); err != nil {
+		required := fmt.Sprintf("~%d.%d", v.Major, v.Minor)
+		if !requiredMermaidPattern.Match(updated) {
+			return fmt.Errorf("%v, and MermaidVersionRequired was not found in %s to update", err, mermaidGoPath)
+		}
+		updated = requiredMermaidPattern.ReplaceAll(updated, []byte(`${1}"`+required+`"`))
+		fmt.Printf("ℹ️  MermaidVersionRequired %q → %q\n", MermaidVersionRequired, required)
+	}
+	if err := os.WriteFile(mermaidGoPath, updated, 0644); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Pinned Mermaid CLI %s. Commit %s/package.json, %s/package-lock.json and %s.\n",
+		version, toolsDir, toolsDir, mermaidGoPath)
+	return nil
+}
+
+// mermaidGoPath is this file; Mermaid.Upgrade rewrites its version pin.
+const mermaidGoPath = "magefiles/mermaid.go"
+
+// targetMermaidPattern matches the TargetMermaidVersion declaration.
+var targetMermaidPattern = regexp.MustCompile(`(const TargetMermaidVersion = )"[^"]*"`)
+
+// requiredMermaidPattern matches the MermaidVersionRequired declaration.
+var requiredMermaidPattern = regexp.MustCompile(`(MermaidVersionRequired\s*= )"[^"]*"`)
+
+// installLocalMermaid installs tools/ dependencies with npm ci, so every
+// machine gets the exact tree in the committed lockfile, puppeteer and its
+// Chromium revision included.
+func installLocalMermaid() error {
+	if err := checkToolsLockfile(); err != nil {
+		return err
+	}
+	return sh.RunV("npm", "ci", "--prefix", toolsDir)
+}
+
+// mermaidLockKey is the Mermaid CLI entry in a lockfileVersion 2/3 lockfile.
+const mermaidLockKey = "node_modules/@mermaid-js/mermaid-cli"
+
+// checkToolsLockfile makes sure tools/package-lock.json exists and resolves
+// the Mermaid CLI to TargetMermaidVersion, so npm ci and the renderer image
+// install the pinned version rather than whatever the lockfile last saw.
+func checkToolsLockfile() error {
+	data, err := os.ReadFile(toolsLockfile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%s is missing — run mage mermaid:lock and commit it", toolsLockfile)
+	}
+	if err != nil {
+		return err
+	}
+	var lock struct {
+		Packages map[string]struct {
+			Version string `json:"version"`
+		} `json:"packages"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return fmt.Errorf("cannot parse %s: %w", toolsLockfile, err)
+	}
+	pkg, ok := lock.Packages[mermaidLockKey]
+	if !ok {
+		return fmt.Errorf("%s does not lock @mermaid-js/mermaid-cli — run mage mermaid:lock and commit it", toolsLockfile)
+	}
+	if pkg.Version != TargetMermaidVersion {
+		return fmt.Errorf("%s locks Mermaid CLI %s but TargetMermaidVersion is %s — run mage mermaid:lock and commit it",
+			toolsLockfile, pkg.Version, TargetMermaidVersion)
+	}
+	return nil
+}
+
+// Lock regenerates tools/package-lock.json from tools/package.json without
+// installing anything. Commit the result.
+func (Mermaid) Lock() error {
+	fmt.Printf("🔒 Resolving %s/package.json into %s...\n", toolsDir, toolsLockfile)
+	if err := sh.RunV("npm", "install", "--prefix", toolsDir, "--package-lock-only"); err != nil {
+		return fmt.Errorf("failed to generate %s: %w", toolsLockfile, err)
+	}
+	if err := checkToolsLockfile(); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Wrote %s. Commit it.\n", toolsLockfile)
+	return nil
+}
+
 // Version prints the currently installed Mermaid CLI version.
 func (Mermaid) Version() error {
-	out, err := exec.Command("mmdc", "--version").CombinedOutput()
+	cmd, err := mmdcCommand("--version")
+	if err != nil {
+		return err
+	}
+	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return errors.New("Mermaid CLI not found in PATH.")
 	}
-	fmt.Printf("Mermaid CLI version: %s\n", strings.TrimSpace(string(out)))
+	fmt.Printf("Mermaid CLI version: %s (%s)\n", strings.TrimSpace(string(out)), rendererMode())
 	return nil
 }
 
-// VerifySystemLibs ensures system libraries required for headless Chromium are installed.
+// mermaidVersion returns the output of mmdc --version where diagrams are rendered.
+func mermaidVersion() (string, error) {
+	cmd, err := mmdcCommand("--version")
+	if err != nil {
+		return "", err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to run mmdc --version: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// VerifySystemLibs ensures the shared libraries headless Chromium loads can be
+// resolved, installing the providing packages for the detected distro if not.
 func (Mermaid) VerifySystemLibs() error {
 	fmt.Println("🔍 Verifying required system libraries for Mermaid CLI...")
 
-	libs := []string{
-		"libatk1.0-0t64", "libatk-bridge2.0-0t64", "libcups2t64", "libdrm2", "libxkbcommon0",
-		"libxdamage1", "libxfixes3", "libxrandr2", "libasound2t64", "libatspi2.0-0t64",
-		"libpangocairo-1.0-0", "libpango-1.0-0", "libcairo2", "libgbm1", "libnss3",
-		"libxshmfence1", "libxcomposite1", "libxext6", "libx11-6", "libx11-xcb1",
-		"libxcb1", "libxrender1", "fonts-liberation", "libgtk-3-0t64",
-	}
-
-	missing := []string{}
-	for _, pkg := range libs {
-		cmd := exec.Command("dpkg", "-s", pkg)
-		if err := cmd.Run(); err != nil {
-			missing = append(missing, pkg)
-		}
-	}
+	missing := missingSystemLibs()
 
 	if len(missing) == 0 {
 		fmt.Println("✅ All required system libraries are installed.")
@@ -124,20 +265,22 @@ func (Mermaid) VerifySystemLibs() error {
 	}
 
 	fmt.Printf("⚠️  Missing %d libraries:\n", len(missing))
-	for _, pkg := range missing {
-		fmt.Printf("   - %s\n", pkg)
+	for _, lib := range missing {
+		fmt.Printf("   - %s\n", lib)
 	}
 
-	fmt.Println("\nInstalling missing libraries (requires sudo)...")
-
-	// Step 1: Update package lists
-	if err := sh.RunV("sudo", "apt-get", "update", "-q"); err != nil {
-		return fmt.Errorf("failed to update package lists: %w", err)
+	d, err := detectDistro()
+	if err != nil {
+		return err
+	}
+	pkgs, unknown := d.packagesFor(missing)
+	if len(unknown) > 0 {
+		return fmt.Errorf("no package known for %s on %s; install them manually or use DIAGRAMS_RENDERER=container",
+			strings.Join(unknown, ", "), d.Name)
 	}
 
-	// Step 2: Install missing libraries
-	args := append([]string{"apt-get", "install", "-y"}, missing...)
-	if err := sh.RunV("sudo", args...); err != nil {
+	fmt.Printf("\nInstalling missing libraries for %s...\n", d.Name)
+	if err := d.install(pkgs); err != nil {
 		return fmt.Errorf("failed to install required libraries: %w", err)
 	}
 
@@ -0,0 +1,56 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckToolsLockfile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := checkToolsLockfile(); err == nil || !strings.Contains(err.Error(), "is missing") {
+		t.Errorf("missing lockfile: error = %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(toolsLockfile), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, lock, wantErr string
+	}{
+		{"pinned", `{"lockfileVersion": 3, "packages": {"": {}, "node_modules/@mermaid-js/mermaid-cli": {"version": "` + TargetMermaidVersion + `"}}}`, ""},
+		{"stale", `{"lockfileVersion": 3, "packages": {"node_modules/@mermaid-js/mermaid-cli": {"version": "10.8.0"}}}`, "locks Mermaid CLI 10.8.0"},
+		{"no mermaid", `{"lockfileVersion": 3, "packages": {"": {}}}`, "does not lock"},
+		{"corrupt", `{"packages": `, "cannot parse"},
+	} {
+		if err := os.WriteFile(toolsLockfile, []byte(tc.lock), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := checkToolsLockfile()
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: error = %v, want %q", tc.name, err, tc.wantErr)
+		}
+	}
+}
+
+func TestCompareVersionsRefusesContainerRenderer(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("DIAGRAMS_RENDERER", rendererContainer)
+	candidate := filepath.Join(t.TempDir(), "mmdc")
+	if err := os.WriteFile(candidate, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	err := (Mermaid{}).CompareVersions(candidate)
+	if err == nil || !strings.Contains(err.Error(), "DIAGRAMS_RENDERER=host") {
+		t.Errorf("error = %v, want container mode refused", err)
+	}
+	if _, err := os.Stat(mermaidCompareDir); err == nil {
+		t.Error("the refused comparison still created its output directory")
+	}
+}
@@ -0,0 +1,268 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// mermaidCompareDir holds both renders, diff images and report.json. Like
+// visualDiffDir it sits inside the repo so the container renderer can write it.
+const mermaidCompareDir = "build/mermaid-compare"
+
+// Outcomes of rendering one diagram with the pinned and candidate mmdc.
+const (
+	compareIdentical = "identical"
+	compareMinor     = "within tolerance"
+	compareChanged   = "changed"
+	compareFailed    = "failed"
+)
+
+// mermaidCompareReport is the JSON form of Mermaid.CompareVersions.
+type mermaidCompareReport struct {
+	Pinned    mmdcBinary              `json:"pinned"`
+	Candidate mmdcBinary              `json:"candidate"`
+	Threshold int                     `json:"threshold"`
+	Tolerance float64                 `json:"tolerancePercent"`
+	Summary   map[string]int          `json:"summary"`
+	Diagrams  []mermaidCompareDiagram `json:"diagrams"`
+}
+
+// mmdcBinary identifies one side of the comparison.
+type mmdcBinary struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+// mermaidCompareDiagram is the outcome for one diagram.
+type mermaidCompareDiagram struct {
+	Name           string  `json:"name"`
+	Status         string  `json:"status"`
+	PercentChanged float64 `json:"percentChanged,omitempty"`
+	SizeChange     string  `json:"sizeChange,omitempty"`
+	PinnedError    string  `json:"pinnedError,omitempty"`
+	CandidateError string  `json:"candidateError,omitempty"`
+	Diff           string  `json:"diff,omitempty"`
+}
+
+// CompareVersions renders every Mermaid diagram with the pinned mmdc and with
+// the candidate binary at candidatePath, then reports which diagrams fail to
+// parse, which change visually beyond DIFF_THRESHOLD/DIFF_TOLERANCE (see
+// Diagrams.Diff) and which are identical. Both binaries run on the host, so
+// the container renderer is refused rather than comparing across
+// environments. Results go to the console and build/mermaid-compare/report.json.
+func (Mermaid) CompareVersions(candidatePath string) error {
+	if mode := rendererMode(); mode != rendererHost {
+		return fmt.Errorf("mermaid:compareVersions runs the pinned and candidate mmdc side by side on the host, but the renderer is %q — rerun with DIAGRAMS_RENDERER=%s", mode, rendererHost)
+	}
+	candidate, err := filepath.Abs(expandHome(candidatePath))
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(candidate); err != nil {
+		return fmt.Errorf("candidate mmdc not found: %w", err)
+	}
+
+	threshold, err := envInt("DIFF_THRESHOLD", defaultDiffThreshold)
+	if err != nil {
+		return err
+	}
+	tolerance, err := envFloat("DIFF_TOLERANCE", defaultDiffTolerance)
+	if err != nil {
+		return err
+	}
+
+	pinnedCmd, err := mmdcCommand()
+	if err != nil {
+		return err
+	}
+	report := mermaidCompareReport{
+		Pinned:    mmdcBinary{Path: pinnedCmd.Path, Version: mmdcVersion(mmdcCommand)},
+		Candidate: mmdcBinary{Path: candidate, Version: mmdcVersion(candidateCommand(candidate))},
+		Threshold: threshold,
+		Tolerance: tolerance,
+		Summary:   map[string]int{},
+	}
+	fmt.Printf("🔬 Comparing Mermaid CLI %s (pinned) with %s (%s)...\n",
+		report.Pinned.Version, report.Candidate.Version, candidate)
+
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(mermaidCompareDir); err != nil {
+		return err
+	}
+	for _, dir := range []string{"pinned", "candidate", "diff"} {
+		if err := ensureDir(filepath.Join(mermaidCompareDir, dir)); err != nil {
+			return err
+		}
+	}
+
+	sources, err := filepath.Glob(filepath.Join(srcMDDir, "*.md"))
+	if err != nil {
+		return err
+	}
+	for _, mdPath := range sources {
+		if r, err := detectRenderer(mdPath); err != nil || r.fence != "mermaid" {
+			continue
+		}
+		base := strings.TrimSuffix(filepath.Base(mdPath), ".md")
+		d, err := compareMermaidDiagram(base, mdPath, cfg, candidate, threshold, tolerance)
+		if err != nil {
+			return fmt.Errorf("failed to compare %s: %w", base, err)
+		}
+		report.Diagrams = append(report.Diagrams, d)
+		report.Summary[d.Status]++
+	}
+
+	fmt.Println()
+	for _, d := range report.Diagrams {
+		switch d.Status {
+		case compareIdentical:
+			fmt.Printf("✅ %-32s identical\n", d.Name)
+		case compareMinor:
+			fmt.Printf("✅ %-32s %.2f%% pixels differ (within tolerance)\n", d.Name, d.PercentChanged)
+		case compareChanged:
+			fmt.Printf("⚠️  %-32s %.2f%% pixels differ%s → %s\n", d.Name, d.PercentChanged, d.SizeChange, d.Diff)
+		case compareFailed:
+			fmt.Printf("❌ %-32s failed", d.Name)
+			if d.PinnedError != "" {
+				fmt.Printf("\n   pinned:    %s", d.PinnedError)
+			}
+			if d.CandidateError != "" {
+				fmt.Printf("\n   candidate: %s", d.CandidateError)
+			}
+			fmt.Println()
+		}
+	}
+
+	reportPath := filepath.Join(mermaidCompareDir, "report.json")
+	if err := writeJSON(reportPath, report); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d identical, %d within tolerance, %d changed, %d failed. Report: %s\n",
+		report.Summary[compareIdentical], report.Summary[compareMinor],
+		report.Summary[compareChanged], report.Summary[compareFailed], reportPath)
+	return nil
+}
+
+// compareMermaidDiagram renders one diagram with both binaries and diffs them.
+func compareMermaidDiagram(base, mdPath string, cfg projectConfig, candidate string, threshold int, tolerance float64) (mermaidCompareDiagram, error) {
+	d := mermaidCompareDiagram{Name: base}
+
+	t, err := loadTheme(cfg.themeFor(base))
+	if err != nil {
+		return d, err
+	}
+	srcPath := filepath.Join(genMMDDir, base+".mmd")
+	if err := extractDiagram(mdPath, srcPath, "mermaid"); err != nil {
+		return d, err
+	}
+
+	pinnedPath := filepath.Join(mermaidCompareDir, "pinned", base+".png")
+	candidatePath := filepath.Join(mermaidCompareDir, "candidate", base+".png")
+	d.PinnedError = renderCaptured(mmdcCommand, srcPath, pinnedPath, t)
+	d.CandidateError = renderCaptured(candidateCommand(candidate), srcPath, candidatePath, t)
+	if d.PinnedError != "" || d.CandidateError != "" {
+		d.Status = compareFailed
+		return d, nil
+	}
+
+	pinnedImg, err := readPNG(pinnedPath)
+	if err != nil {
+		return d, err
+	}
+	candidateImg, err := readPNG(candidatePath)
+	if err != nil {
+		return d, err
+	}
+	diffImg, changed, total := pixelDiff(pinnedImg, candidateImg, threshold)
+	d.PercentChanged = 100 * float64(changed) / float64(total)
+	if pb, cb := pinnedImg.Bounds(), candidateImg.Bounds(); pb.Size() != cb.Size() {
+		d.SizeChange = fmt.Sprintf(" (size %dx%d → %dx%d)", pb.Dx(), pb.Dy(), cb.Dx(), cb.Dy())
+	}
+
+	switch {
+	case changed == 0 && d.SizeChange == "":
+		d.Status = compareIdentical
+	case d.SizeChange == "" && d.PercentChanged <= tolerance:
+		d.Status = compareMinor
+	default:
+		d.Status = compareChanged
+		d.Diff = filepath.Join(mermaidCompareDir, "diff", base+".png")
+		if err := writePNG(d.Diff, diffImg); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+// renderCaptured renders with command, capturing mmdc's output. It returns
+// the first error line on failure, or "" on success.
+func renderCaptured(command func(args ...string) (*exec.Cmd, error), input, output string, t theme) string {
+	var out bytes.Buffer
+	captured := func(args ...string) (*exec.Cmd, error) {
+		cmd, err := command(args...)
+		if err == nil {
+			cmd.Stdout, cmd.Stderr = &out, &out
+		}
+		return cmd, err
+	}
+
+	if err := renderFileWith(captured, input, output, t); err != nil {
+		if msg := mmdcErrorLine(out.String()); msg != "" {
+			return msg
+		}
+		return err.Error()
+	}
+	if err := normalizePNG(output); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// mmdcErrorLine picks the most useful line from mmdc's output: the first one
+// mentioning an error, else the last non-empty line.
+func mmdcErrorLine(output string) string {
+	var last string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.Contains(strings.ToLower(line), "error") {
+			return truncate(line, 200)
+		}
+		last = line
+	}
+	return truncate(last, 200)
+}
+
+// candidateCommand builds invocations of a candidate mmdc on the host.
+func candidateCommand(path string) func(args ...string) (*exec.Cmd, error) {
+	return func(args ...string) (*exec.Cmd, error) {
+		return hostCommand(path, args...)
+	}
+}
+
+// mmdcVersion returns the version an mmdc reports, or "unknown".
+func mmdcVersion(command func(args ...string) (*exec.Cmd, error)) string {
+	cmd, err := command("--version")
+	if err != nil {
+		return "unknown"
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return "unknown"
+	}
+	if v, err := extractVersion(string(out)); err == nil {
+		return v
+	}
+	return strings.TrimSpace(string(out))
+}
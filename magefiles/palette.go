@@ -0,0 +1,315 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// defaultMinContrast is the WCAG AA threshold for normal-size text.
+const defaultMinContrast = 4.5
+
+// palette is the small hand-edited colour definition a theme is generated from.
+type palette struct {
+	Background  string  `json:"background"`
+	Surface     string  `json:"surface"`
+	Accent      string  `json:"accent"`
+	Text        string  `json:"text"`
+	FontFamily  string  `json:"fontFamily,omitempty"`
+	Description string  `json:"description,omitempty"`
+	MinContrast float64 `json:"minContrast,omitempty"`
+
+	// Overrides pins derived colours by key (see derivedColorKeys) for the
+	// rare palette the formulas below do not suit.
+	Overrides map[string]string `json:"overrides,omitempty"`
+}
+
+// derivedColorKeys are the palette.json override keys: the Mermaid theme
+// variables generated from the palette, plus clusterStroke for theme.css.
+var derivedColorKeys = []string{
+	"secondaryColor", "tertiaryColor", "noteBkgColor", "clusterBkg", "titleColor", "clusterStroke",
+}
+
+// mermaidThemeConfig mirrors the layout of the hand-written Mermaid configs so
+// generated files keep a stable key order.
+type mermaidThemeConfig struct {
+	Theme          string                `json:"theme"`
+	ThemeVariables mermaidThemeVariables `json:"themeVariables"`
+	Flowchart      mermaidFlowchart      `json:"flowchart"`
+}
+
+type mermaidThemeVariables struct {
+	Background         string `json:"background"`
+	PrimaryColor       string `json:"primaryColor"`
+	PrimaryBorderColor string `json:"primaryBorderColor"`
+	PrimaryTextColor   string `json:"primaryTextColor"`
+
+	SecondaryColor string `json:"secondaryColor"`
+	TertiaryColor  string `json:"tertiaryColor"`
+	LineColor      string `json:"lineColor"`
+
+	FontFamily string `json:"fontFamily"`
+	FontSize   string `json:"fontSize"`
+
+	DiagramPadding      int    `json:"diagramPadding"`
+	Padding             int    `json:"padding"`
+	NodeSpacing         int    `json:"nodeSpacing"`
+	NoteBkgColor        string `json:"noteBkgColor"`
+	NoteTextColor       string `json:"noteTextColor"`
+	EdgeLabelBackground string `json:"edgeLabelBackground"`
+	ClusterBkg          string `json:"clusterBkg"`
+	ClusterBorder       string `json:"clusterBorder"`
+	TitleColor          string `json:"titleColor"`
+}
+
+type mermaidFlowchart struct {
+	HTMLLabels  bool   `json:"htmlLabels"`
+	UseMaxWidth bool   `json:"useMaxWidth"`
+	Curve       string `json:"curve"`
+	NodeSpacing int    `json:"nodeSpacing"`
+	RankSpacing int    `json:"rankSpacing"`
+}
+
+// GenerateThemes regenerates every theme that has a palette.json: the Mermaid
+// config, theme.json, theme.css, and the PlantUML and D2 settings.
+func (Diagrams) GenerateThemes() error {
+	fmt.Println("🎨 Generating themes from palettes...")
+
+	entries, err := os.ReadDir(themesDir)
+	if err != nil {
+		return err
+	}
+
+	generated := 0
+	for _, e := range entries {
+		palettePath := filepath.Join(themesDir, e.Name(), "palette.json")
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(palettePath); err != nil {
+			continue
+		}
+		if err := generateTheme(e.Name()); err != nil {
+			return fmt.Errorf("theme %s: %w", e.Name(), err)
+		}
+		generated++
+	}
+
+	fmt.Printf("✅ Generated %d themes.\n", generated)
+	return nil
+}
+
+// generateTheme derives all renderer settings for one theme from its palette.
+func generateTheme(name string) error {
+	dir := filepath.Join(themesDir, name)
+	p, err := loadPalette(filepath.Join(dir, "palette.json"))
+	if err != nil {
+		return err
+	}
+
+	d := p.derivedColors()
+	if err := p.checkContrast(d); err != nil {
+		return err
+	}
+
+	cfg := mermaidThemeConfig{
+		Theme: "base",
+		ThemeVariables: mermaidThemeVariables{
+			Background:          p.Background,
+			PrimaryColor:        p.Surface,
+			PrimaryBorderColor:  p.Accent,
+			PrimaryTextColor:    p.Text,
+			SecondaryColor:      d["secondaryColor"],
+			TertiaryColor:       d["tertiaryColor"],
+			LineColor:           p.Accent,
+			FontFamily:          p.FontFamily,
+			FontSize:            "12px",
+			DiagramPadding:      100,
+			Padding:             35,
+			NodeSpacing:         45,
+			NoteBkgColor:        d["noteBkgColor"],
+			NoteTextColor:       p.Text,
+			EdgeLabelBackground: p.Surface,
+			ClusterBkg:          d["clusterBkg"],
+			ClusterBorder:       p.Accent,
+			TitleColor:          d["titleColor"],
+		},
+		Flowchart: mermaidFlowchart{
+			HTMLLabels:  true,
+			UseMaxWidth: true,
+			Curve:       "basis",
+			NodeSpacing: 50,
+			RankSpacing: 70,
+		},
+	}
+	if err := writeJSON(filepath.Join(dir, "mermaid-config.json"), cfg); err != nil {
+		return err
+	}
+
+	t := theme{Name: name, Dir: dir, Description: p.Description, Background: p.Background}
+	if err := writeJSON(filepath.Join(dir, "theme.json"), t); err != nil {
+		return err
+	}
+
+	css := fmt.Sprintf(".cluster rect, svg { stroke: %s !important; stroke-width: 2px !important; }\n",
+		d["clusterStroke"])
+	if err := os.WriteFile(filepath.Join(dir, "theme.css"), []byte(css), 0644); err != nil {
+		return err
+	}
+
+	if err := writePlantUMLSkin(t, filepath.Join(dir, "skin.iuml")); err != nil {
+		return err
+	}
+	if err := writeD2Theme(t, filepath.Join(dir, "theme.d2")); err != nil {
+		return err
+	}
+
+	fmt.Printf("   - %s: written to %s\n", name, dir)
+	return nil
+}
+
+// loadPalette reads and validates a palette file.
+func loadPalette(path string) (palette, error) {
+	p := palette{FontFamily: "DejaVu Sans, Segoe UI, Roboto, Helvetica, Arial, sans-serif", MinContrast: defaultMinContrast}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return p, err
+	}
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	for field, value := range map[string]string{
+		"background": p.Background, "surface": p.Surface, "accent": p.Accent, "text": p.Text,
+	} {
+		if _, err := parseHex(value); err != nil {
+			return p, fmt.Errorf("%s: invalid %s colour: %w", path, field, err)
+		}
+	}
+	for key, value := range p.Overrides {
+		if !slices.Contains(derivedColorKeys, key) {
+			return p, fmt.Errorf("%s: unknown override %q (expected one of %s)", path, key, strings.Join(derivedColorKeys, ", "))
+		}
+		if _, err := parseHex(value); err != nil {
+			return p, fmt.Errorf("%s: invalid %s override: %w", path, key, err)
+		}
+	}
+	return p, nil
+}
+
+// derivedColors computes the colours generated from the palette, keyed like
+// derivedColorKeys, with any overrides applied.
+func (p palette) derivedColors() map[string]string {
+	// Titles and borders push away from the background: lighter on dark
+	// themes, darker on light ones.
+	extreme := "#FFFFFF"
+	if !isDark(p.Background) {
+		extreme = "#000000"
+	}
+
+	// Secondary fills step from the surface towards the background; notes and
+	// clusters are the background tinted with the accent, notes a little more.
+	d := map[string]string{
+		"secondaryColor": mixHex(p.Surface, p.Background, 0.4),
+		"tertiaryColor":  mixHex(p.Surface, p.Background, 0.7),
+		"noteBkgColor":   mixHex(p.Background, p.Accent, 0.12),
+		"clusterBkg":     mixHex(p.Background, p.Accent, 0.09),
+		"titleColor":     mixHex(p.Text, extreme, 0.5),
+		"clusterStroke":  mixHex(p.Surface, extreme, 0.07),
+	}
+	for key, value := range p.Overrides {
+		d[key] = strings.ToUpper(value)
+	}
+	return d
+}
+
+// checkContrast fails when any text colour does not meet the minimum WCAG
+// contrast ratio against what it is drawn on: node text on the background and
+// the surface, note text on the note background, and titles on the background.
+func (p palette) checkContrast(d map[string]string) error {
+	for _, pair := range []struct{ fg, fgColor, bg, bgColor string }{
+		{"text", p.Text, "background", p.Background},
+		{"text", p.Text, "surface", p.Surface},
+		{"note text", p.Text, "noteBkgColor", d["noteBkgColor"]},
+		{"titleColor", d["titleColor"], "background", p.Background},
+	} {
+		ratio := contrastRatio(pair.fgColor, pair.bgColor)
+		if ratio < p.MinContrast {
+			return fmt.Errorf("❌ %s %s on %s %s has contrast %.2f:1, below the required %.1f:1",
+				pair.fg, pair.fgColor, pair.bg, pair.bgColor, ratio, p.MinContrast)
+		}
+		fmt.Printf("   %s on %s: %.2f:1\n", pair.fg, pair.bg, ratio)
+	}
+	return nil
+}
+
+// parseHex parses #RGB or #RRGGBB into its components.
+func parseHex(s string) ([3]uint8, error) {
+	h := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(h) == 3 {
+		h = string([]byte{h[0], h[0], h[1], h[1], h[2], h[2]})
+	}
+	if len(h) != 6 {
+		return [3]uint8{}, fmt.Errorf("%q is not a #RRGGBB colour", s)
+	}
+	v, err := strconv.ParseUint(h, 16, 32)
+	if err != nil {
+		return [3]uint8{}, fmt.Errorf("%q is not a #RRGGBB colour", s)
+	}
+	return [3]uint8{uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// mixHex blends a towards b by t (0 keeps a, 1 gives b).
+func mixHex(a, b string, t float64) string {
+	ca, _ := parseHex(a)
+	cb, _ := parseHex(b)
+	var out [3]uint8
+	for i := range out {
+		out[i] = uint8(math.Round(float64(ca[i]) + (float64(cb[i])-float64(ca[i]))*t))
+	}
+	return fmt.Sprintf("#%02X%02X%02X", out[0], out[1], out[2])
+}
+
+// relativeLuminance implements the WCAG 2.x relative luminance formula.
+func relativeLuminance(hex string) float64 {
+	c, _ := parseHex(hex)
+	channel := func(v uint8) float64 {
+		s := float64(v) / 255
+		if s <= 0.03928 {
+			return s / 12.92
+		}
+		return math.Pow((s+0.055)/1.055, 2.4)
+	}
+	return 0.2126*channel(c[0]) + 0.7152*channel(c[1]) + 0.0722*channel(c[2])
+}
+
+// contrastRatio returns the WCAG contrast ratio between two colours (1 to 21).
+func contrastRatio(a, b string) float64 {
+	la, lb := relativeLuminance(a), relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// isDark reports whether a colour is closer to black than to white.
+func isDark(hex string) bool {
+	return relativeLuminance(hex) < 0.18
+}
+
+// writeJSON writes v as two-space indented JSON with a trailing newline.
+func writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
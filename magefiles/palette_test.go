@@ -0,0 +1,98 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writePalette(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "palette.json")
+	if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestPaletteOverrides(t *testing.T) {
+	p, err := loadPalette(writePalette(t, `{
+		"background": "#1B1B2F", "surface": "#2E2E48", "accent": "#A09BFF", "text": "#A09BFF",
+		"overrides": {"noteBkgColor": "#2a2a4a", "clusterStroke": "#3A3A50"}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := p.derivedColors()
+	if d["noteBkgColor"] != "#2A2A4A" || d["clusterStroke"] != "#3A3A50" {
+		t.Errorf("overrides not applied: %v", d)
+	}
+	if d["secondaryColor"] != mixHex(p.Surface, p.Background, 0.4) {
+		t.Errorf("secondaryColor = %s, want the derived value", d["secondaryColor"])
+	}
+
+	for body, want := range map[string]string{
+		`{"background": "#000", "surface": "#111", "accent": "#FFF", "text": "#FFF", "overrides": {"lineColor": "#123456"}}`: `unknown override "lineColor"`,
+		`{"background": "#000", "surface": "#111", "accent": "#FFF", "text": "#FFF", "overrides": {"titleColor": "blue"}}`:   "invalid titleColor override",
+	} {
+		if _, err := loadPalette(writePalette(t, body)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("loadPalette error = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestPaletteContrastCoversNotesAndTitles(t *testing.T) {
+	base := palette{Background: "#FFFFFF", Surface: "#F0F0F0", Accent: "#333333", Text: "#222222", MinContrast: defaultMinContrast}
+	if err := base.checkContrast(base.derivedColors()); err != nil {
+		t.Fatalf("readable palette rejected: %v", err)
+	}
+
+	for _, tc := range []struct{ key, value, want string }{
+		{"noteBkgColor", "#333333", "note text #222222 on noteBkgColor #333333"},
+		{"titleColor", "#EEEEEE", "titleColor #EEEEEE on background #FFFFFF"},
+	} {
+		p := base
+		p.Overrides = map[string]string{tc.key: tc.value}
+		if err := p.checkContrast(p.derivedColors()); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s override: error = %v, want %q", tc.key, err, tc.want)
+		}
+	}
+}
+
+func TestBundledPalettesNeedNoOverrides(t *testing.T) {
+	// navy's colours were hand-tuned before generation existed; the formulas
+	// must stay close to them.
+	legacyNavy := map[string]string{
+		"secondaryColor": "#252540", "tertiaryColor": "#202036", "noteBkgColor": "#2A2A4A",
+		"clusterBkg": "#232346", "titleColor": "#D0C8FF", "clusterStroke": "#3A3A50",
+	}
+	for _, name := range []string{"navy", "paper"} {
+		p, err := loadPalette(filepath.Join("..", themesDir, name, "palette.json"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Overrides) > 0 {
+			t.Errorf("%s pins %v; tune derivedColors instead", name, p.Overrides)
+		}
+		d := p.derivedColors()
+		if err := p.checkContrast(d); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if name != "navy" {
+			continue
+		}
+		for key, want := range legacyNavy {
+			got, _ := parseHex(d[key])
+			legacy, _ := parseHex(want)
+			for i := range got {
+				if diff := int(got[i]) - int(legacy[i]); diff > 8 || diff < -8 {
+					t.Errorf("navy %s = %s, too far from the hand-tuned %s", key, d[key], want)
+					break
+				}
+			}
+		}
+	}
+}
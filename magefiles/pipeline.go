@@ -0,0 +1,112 @@
+//go:build mage
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/magefile/mage/mg"
+	"github.com/magefile/mage/sh"
+)
+
+// composeFilePath is where Docker.Compose writes the generated Compose file.
+var composeFilePath = "build/docker/compose.yaml"
+
+// pipelineCommand is what Docker.Run executes inside the renderer image.
+var pipelineCommand = []string{"mage", "mermaid:all", "publish:git"}
+
+// Compose writes a Compose file that runs the full pipeline in the renderer
+// image with the repo mounted and the GitHub App key as a file-backed secret.
+func (Docker) Compose() error {
+	path, err := writeComposeFile()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Compose file written: %s\n", path)
+	fmt.Printf("   Run it with: docker compose -f %s run --rm pipeline\n", path)
+	return nil
+}
+
+// Run executes Mermaid.All and Publish.Git inside the renderer image. The
+// repo is mounted at /work and the GitHub App key reaches the container only
+// as a secret mounted at /run/secrets/wiki_diagram_app_key — never as an
+// environment variable or an image layer. Logs stream through and the
+// container's exit code becomes mage's exit code.
+func (Docker) Run() error {
+	fmt.Println("🐋 Running the diagram pipeline in the renderer image...")
+
+	if err := verifyDockerEngine(); err != nil {
+		return err
+	}
+	if !rendererImageExists() {
+		if err := (Docker{}).BuildRenderer(); err != nil {
+			return err
+		}
+	}
+
+	path, err := writeComposeFile()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("▶️  %s\n", strings.Join(pipelineCommand, " "))
+	if err := sh.RunV(dockerBin(), "compose", "-f", path, "run", "--rm", "pipeline"); err != nil {
+		return mg.Fatalf(sh.ExitStatus(err), "pipeline container failed: %v", err)
+	}
+
+	fmt.Println("✅ Containerised pipeline completed successfully.")
+	return nil
+}
+
+// writeComposeFile renders the Compose file for the pipeline service.
+func writeComposeFile() (string, error) {
+	choice, err := resolveGitHubAppKey()
+	if err != nil {
+		return "", err
+	}
+	if _, err := inspectGitHubAppKey(choice.Path, expectedGitHubAppKeyFingerprint()); err != nil {
+		return "", err
+	}
+	keyPath, err := filepath.Abs(choice.Path)
+	if err != nil {
+		return "", err
+	}
+	repo, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	quoted := make([]string, len(pipelineCommand))
+	for i, arg := range pipelineCommand {
+		quoted[i] = fmt.Sprintf("%q", arg)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by mage docker:compose. Do not edit.\n")
+	fmt.Fprintf(&b, "name: wiki-diagrams\n\n")
+	fmt.Fprintf(&b, "services:\n")
+	fmt.Fprintf(&b, "  pipeline:\n")
+	fmt.Fprintf(&b, "    image: %s\n", rendererImage)
+	fmt.Fprintf(&b, "    user: \"%d:%d\"\n", os.Getuid(), os.Getgid())
+	fmt.Fprintf(&b, "    working_dir: /work\n")
+	fmt.Fprintf(&b, "    volumes:\n")
+	fmt.Fprintf(&b, "      - %q\n", repo+":/work")
+	fmt.Fprintf(&b, "    environment:\n")
+	fmt.Fprintf(&b, "      DIAGRAMS_RENDERER: %s\n", rendererHost)
+	fmt.Fprintf(&b, "      WIKI_DIAGRAM_APP_ID: ${WIKI_DIAGRAM_APP_ID:-}\n")
+	fmt.Fprintf(&b, "      PUBLISH_DRY_RUN: ${PUBLISH_DRY_RUN:-}\n")
+	fmt.Fprintf(&b, "    secrets:\n")
+	fmt.Fprintf(&b, "      - wiki_diagram_app_key\n")
+	fmt.Fprintf(&b, "    command: [%s]\n\n", strings.Join(quoted, ", "))
+	fmt.Fprintf(&b, "secrets:\n")
+	fmt.Fprintf(&b, "  wiki_diagram_app_key:\n")
+	fmt.Fprintf(&b, "    file: %q\n", keyPath)
+
+	if err := ensureDir(filepath.Dir(composeFilePath)); err != nil {
+		return "", err
+	}
+	return composeFilePath, os.WriteFile(composeFilePath, []byte(b.String()), 0644)
+}
@@ -0,0 +1,231 @@
+//go:build mage
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/magefile/mage/mg"
+	"github.com/magefile/mage/sh"
+)
+
+// PlantUML namespace groups all PlantUML renderer tasks.
+type PlantUML mg.Namespace
+
+// TargetPlantUMLVersion defines the pinned PlantUML jar version.
+const TargetPlantUMLVersion = "1.2024.7"
+
+// PlantUML version constraints, see checkToolVersion.
+const (
+	PlantUMLVersionRequired    = "~1.2024"
+	PlantUMLVersionRecommended = "=" + TargetPlantUMLVersion
+)
+
+// Verify checks that Java, Graphviz and the pinned PlantUML jar are available.
+func (PlantUML) Verify() error {
+	fmt.Println("Verifying PlantUML installation...")
+
+	if _, err := exec.LookPath("java"); err != nil {
+		return errors.New("❌ Java runtime not found in PATH. Install it with:\n   sudo apt-get install -y default-jre-headless")
+	}
+	if _, err := exec.LookPath("dot"); err != nil {
+		return errors.New("❌ Graphviz 'dot' not found in PATH. Install it with:\n   sudo apt-get install -y graphviz")
+	}
+
+	version, err := plantUMLVersion()
+	if err != nil {
+		return err
+	}
+	v, err := checkToolVersion("PlantUML", version, PlantUMLVersionRequired, PlantUMLVersionRecommended)
+	if err != nil {
+		return fmt.Errorf("❌ %w", err)
+	}
+
+	fmt.Printf("✅ PlantUML %s verified successfully.\n", v)
+	return nil
+}
+
+// Deps ensures Java, Graphviz and the pinned PlantUML jar are installed.
+func (PlantUML) Deps() error {
+	fmt.Println("Ensuring PlantUML dependencies...")
+
+	if err := (PlantUML{}).Verify(); err == nil {
+		fmt.Println("✅ PlantUML already installed and up to date.")
+		return nil
+	}
+
+	// Step 1: Java runtime and Graphviz (used for non-sequence layouts)
+	if _, err := exec.LookPath("java"); err != nil {
+		if err := aptInstall("default-jre-headless"); err != nil {
+			return fmt.Errorf("failed to install Java runtime: %w", err)
+		}
+	}
+	if _, err := exec.LookPath("dot"); err != nil {
+		if err := aptInstall("graphviz"); err != nil {
+			return fmt.Errorf("failed to install Graphviz: %w", err)
+		}
+	}
+
+	// Step 2: Download the pinned jar
+	jar := plantUMLJar()
+	url := fmt.Sprintf("https://github.com/plantuml/plantuml/releases/download/v%s/plantuml-%s.jar",
+		TargetPlantUMLVersion, TargetPlantUMLVersion)
+
+	fmt.Printf("Downloading PlantUML %s to %s...\n", TargetPlantUMLVersion, jar)
+	if err := ensureDir(filepath.Dir(jar)); err != nil {
+		return err
+	}
+	if err := sh.RunV("curl", "-fL", "-o", jar, url); err != nil {
+		return fmt.Errorf("failed to download PlantUML %s: %w", TargetPlantUMLVersion, err)
+	}
+
+	// Step 3: Re-verify installation
+	fmt.Println("Re-verifying PlantUML installation...")
+	if err := (PlantUML{}).Verify(); err != nil {
+		return fmt.Errorf("PlantUML installation did not verify successfully: %w", err)
+	}
+
+	fmt.Printf("✅ PlantUML %s successfully installed and verified.\n", TargetPlantUMLVersion)
+	return nil
+}
+
+// Version prints the currently installed PlantUML version.
+func (PlantUML) Version() error {
+	version, err := plantUMLVersion()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("PlantUML version: %s\n", version)
+	return nil
+}
+
+// plantUMLJar returns the jar path, honouring the PLANTUML_JAR override.
+func plantUMLJar() string {
+	if jar := os.Getenv("PLANTUML_JAR"); jar != "" {
+		return jar
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".local", "share", "plantuml", "plantuml-"+TargetPlantUMLVersion+".jar")
+}
+
+// plantUMLVersion returns the first line of `plantuml -version`.
+func plantUMLVersion() (string, error) {
+	jar := plantUMLJar()
+	if _, err := os.Stat(jar); err != nil {
+		return "", fmt.Errorf("❌ PlantUML jar not found at %s. Run: mage plantuml:deps", jar)
+	}
+
+	out, err := exec.Command("java", "-jar", jar, "-version").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("❌ failed to run PlantUML jar %s: %w", jar, err)
+	}
+	return strings.TrimSpace(strings.Split(string(out), "\n")[0]), nil
+}
+
+// renderPlantUML renders a .puml file to PNG using the local jar and the
+// skin parameters generated from the theme colours.
+func renderPlantUML(input, output string, t theme) error {
+	// Themes generated from a palette ship their own skin; otherwise derive one.
+	skinPath := filepath.Join(t.Dir, "skin.iuml")
+	if _, err := os.Stat(skinPath); err != nil {
+		skinPath = filepath.Join(genPUMLDir, t.Name+".skin.iuml")
+		if err := writePlantUMLSkin(t, skinPath); err != nil {
+			return fmt.Errorf("failed to generate PlantUML skin: %w", err)
+		}
+	}
+
+	src, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+	// Fences usually omit the @startuml/@enduml wrapper that -pipe requires.
+	if !strings.HasPrefix(strings.TrimSpace(string(src)), "@start") {
+		src = []byte("@startuml\n" + string(src) + "\n@enduml\n")
+	}
+
+	// Java's font manager reads fontconfig, so the bundled fonts apply here too.
+	cmd, err := hostCommand("java", "-Djava.awt.headless=true", "-jar", plantUMLJar(),
+		"-tpng", "-charset", "UTF-8", "-config", skinPath, "-pipe")
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	cmd.Stdin = strings.NewReader(string(src))
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	fmt.Printf("📗 Rendering with skin:\n   - %s\n", skinPath)
+
+	if err := cmd.Run(); err != nil {
+		os.Remove(output)
+		return err
+	}
+	return nil
+}
+
+// writePlantUMLSkin translates the theme colours into PlantUML skinparams.
+func writePlantUMLSkin(t theme, skinPath string) error {
+	c, err := t.colors()
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "' Generated from theme %q by mage. Do not edit.\n", t.Name)
+	fmt.Fprintf(&b, "skinparam backgroundColor %s\n", c.Background)
+	fmt.Fprintf(&b, "skinparam shadowing false\n")
+	fmt.Fprintf(&b, "skinparam defaultFontName %s\n", c.primaryFont())
+	fmt.Fprintf(&b, "skinparam defaultFontSize %s\n", c.fontSizePx())
+	fmt.Fprintf(&b, "skinparam defaultFontColor %s\n", c.Text)
+	fmt.Fprintf(&b, "skinparam ArrowColor %s\n", c.Line)
+	fmt.Fprintf(&b, "skinparam ArrowFontColor %s\n", c.Text)
+	fmt.Fprintf(&b, "skinparam TitleFontColor %s\n", c.Title)
+
+	for _, element := range []string{
+		"actor", "participant", "boundary", "control", "entity", "collections",
+		"node", "component", "rectangle", "database", "cloud", "artifact",
+		"queue", "storage", "usecase", "class", "state", "activity",
+	} {
+		fmt.Fprintf(&b, "skinparam %s {\n", element)
+		fmt.Fprintf(&b, "  BackgroundColor %s\n  BorderColor %s\n  FontColor %s\n", c.Primary, c.Border, c.Text)
+		fmt.Fprintf(&b, "}\n")
+	}
+	for _, element := range []string{"package", "frame", "folder"} {
+		fmt.Fprintf(&b, "skinparam %s {\n", element)
+		fmt.Fprintf(&b, "  BackgroundColor %s\n  BorderColor %s\n  FontColor %s\n", c.Cluster, c.Border, c.Title)
+		fmt.Fprintf(&b, "}\n")
+	}
+
+	fmt.Fprintf(&b, "skinparam note {\n  BackgroundColor %s\n  BorderColor %s\n  FontColor %s\n}\n", c.Note, c.Border, c.NoteText)
+	fmt.Fprintf(&b, "skinparam sequence {\n")
+	fmt.Fprintf(&b, "  LifeLineBorderColor %s\n  LifeLineBackgroundColor %s\n", c.Line, c.Secondary)
+	fmt.Fprintf(&b, "  GroupBackgroundColor %s\n  GroupBorderColor %s\n", c.Cluster, c.Border)
+	fmt.Fprintf(&b, "  DividerBackgroundColor %s\n  DividerBorderColor %s\n", c.Secondary, c.Border)
+	fmt.Fprintf(&b, "}\n")
+
+	if err := ensureDir(filepath.Dir(skinPath)); err != nil {
+		return err
+	}
+	return os.WriteFile(skinPath, []byte(b.String()), 0644)
+}
+
+// aptInstall installs Debian/Ubuntu packages with sudo.
+func aptInstall(pkgs ...string) error {
+	fmt.Printf("Installing %s (requires sudo)...\n", strings.Join(pkgs, ", "))
+	if err := sh.RunV("sudo", "apt-get", "update", "-q"); err != nil {
+		return fmt.Errorf("failed to update package lists: %w", err)
+	}
+	args := append([]string{"apt-get", "install", "-y"}, pkgs...)
+	return sh.RunV("sudo", args...)
+}
@@ -0,0 +1,129 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// normalizePNG re-encodes a rendered PNG so identical pixels always produce
+// identical bytes. Decoding and re-encoding with Go's encoder drops every
+// ancillary chunk (tIME, tEXt, pHYs, ...) that renderers fill with timestamps
+// or tool versions, and fixes the compression settings. Non-PNG outputs are
+// left alone.
+func normalizePNG(path string) error {
+	if !strings.EqualFold(filepath.Ext(path), ".png") {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return fmt.Errorf("failed to re-encode %s: %w", path, err)
+	}
+	if bytes.Equal(buf.Bytes(), data) {
+		return nil
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// reproducibleDir holds the two scratch renders compared by CheckReproducible,
+// so the check never touches gen/png.
+const reproducibleDir = "build/reproducible"
+
+// CheckReproducible renders every diagram twice and fails if any output's
+// bytes differ between the two runs.
+func (Diagrams) CheckReproducible() error {
+	fmt.Println("🔁 Rendering all diagrams twice to check reproducibility...")
+
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(reproducibleDir); err != nil {
+		return err
+	}
+
+	var runs [2]map[string]string
+	for i := range runs {
+		dir := filepath.Join(reproducibleDir, fmt.Sprintf("run%d", i+1))
+		fmt.Printf("\n▶️  Render %d of 2 into %s\n", i+1, dir)
+		if err := ensureDir(dir); err != nil {
+			return err
+		}
+		if err := renderAll(cfg, dir); err != nil {
+			return err
+		}
+		sums, err := hashOutputs(dir)
+		if err != nil {
+			return err
+		}
+		runs[i] = sums
+	}
+
+	names := make([]string, 0, len(runs[0]))
+	for name := range runs[0] {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var differ []string
+	fmt.Println()
+	for _, name := range names {
+		first, second := runs[0][name], runs[1][name]
+		if first != second {
+			differ = append(differ, name)
+			fmt.Printf("❌ %s\n   %s\n   %s\n", name, first, second)
+			continue
+		}
+		fmt.Printf("✅ %s  %s\n", first[:12], name)
+	}
+	for name := range runs[1] {
+		if _, ok := runs[0][name]; !ok {
+			differ = append(differ, name)
+			fmt.Printf("❌ %s only produced by the second render\n", name)
+		}
+	}
+
+	if len(differ) > 0 {
+		return fmt.Errorf("%d of %d outputs differ between renders", len(differ), len(names))
+	}
+	fmt.Printf("\n✅ All %d outputs are byte-for-byte reproducible.\n", len(names))
+	return nil
+}
+
+// hashOutputs returns the SHA-256 of every file under dir, keyed by relative path.
+func hashOutputs(dir string) (map[string]string, error) {
+	sums := map[string]string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sums[rel] = sum
+		return nil
+	})
+	return sums, err
+}
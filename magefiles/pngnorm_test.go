@@ -0,0 +1,152 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// withChunk inserts an ancillary chunk right after IHDR.
+func withChunk(data []byte, typ string, payload []byte) []byte {
+	const ihdrEnd = 8 + 4 + 4 + 13 + 4
+	chunk := make([]byte, 0, 12+len(payload))
+	chunk = binary.BigEndian.AppendUint32(chunk, uint32(len(payload)))
+	chunk = append(chunk, typ...)
+	chunk = append(chunk, payload...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	out := append([]byte{}, data[:ihdrEnd]...)
+	out = append(out, chunk...)
+	return append(out, data[ihdrEnd:]...)
+}
+
+func TestNormalizePNGIsDeterministic(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			img.Set(x, y, color.NRGBA{uint8(x * 6), uint8(y * 8), 0x80, 0xFF})
+		}
+	}
+
+	dir := t.TempDir()
+	var paths []string
+	for i, level := range []png.CompressionLevel{png.NoCompression, png.BestSpeed, png.BestCompression} {
+		var buf bytes.Buffer
+		if err := (&png.Encoder{CompressionLevel: level}).Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		data := buf.Bytes()
+		if i > 0 {
+			// Renderers stamp times and tool names into ancillary chunks.
+			data = withChunk(data, "tIME", []byte{0x07, 0xE9, 1, 2, 3, 4, byte(i)})
+			data = withChunk(data, "tEXt", []byte("Software\x00renderer run "+string(rune('0'+i))))
+		}
+		path := filepath.Join(dir, string(rune('a'+i))+".png")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	var want []byte
+	for _, path := range paths {
+		if err := normalizePNG(path); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want == nil {
+			want = got
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("%s normalised to different bytes than %s", filepath.Base(path), filepath.Base(paths[0]))
+		}
+		if bytes.Contains(got, []byte("tIME")) || bytes.Contains(got, []byte("tEXt")) {
+			t.Errorf("%s keeps its ancillary chunks", filepath.Base(path))
+		}
+	}
+
+	// Normalising twice changes nothing.
+	info, _ := os.Stat(paths[0])
+	if err := normalizePNG(paths[0]); err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := os.Stat(paths[0]); !again.ModTime().Equal(info.ModTime()) {
+		t.Error("normalizePNG rewrote an already normalised file")
+	}
+}
+
+// fakeRenderTree sets up a working directory with one Mermaid diagram and the
+// navy theme, and swaps the Mermaid renderer for one that writes a test PNG.
+func fakeRenderTree(t *testing.T) projectConfig {
+	t.Helper()
+	repoTheme, err := filepath.Abs(filepath.Join("..", themesDir, "navy"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	for _, name := range []string{"theme.json", "mermaid-config.json"} {
+		if err := os.MkdirAll(filepath.Join(themesDir, "navy"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := copyFile(filepath.Join(repoTheme, name), filepath.Join(themesDir, "navy", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(srcMDDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcMDDir, "d.md"), []byte("# D\n\n```mermaid\ngraph LR\n  a --> b\n```\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	renderers := diagramRenderers
+	t.Cleanup(func() { diagramRenderers = renderers })
+	diagramRenderers = []diagramRenderer{{
+		fence: "mermaid", genDir: genMMDDir, ext: ".mmd", tool: "mermaid-cli",
+		render: func(input, output string, th theme) error {
+			writeTestPNG(t, output, 120, 80)
+			return nil
+		},
+		version: func() (string, error) { return TargetMermaidVersion, nil },
+	}}
+
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Sizes = nil
+	return cfg
+}
+
+func TestScratchRendersLeaveGenUntouched(t *testing.T) {
+	cfg := fakeRenderTree(t)
+	dir := filepath.Join(reproducibleDir, "run1")
+	if err := renderAll(cfg, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir+"-src", "d.mmd")); err != nil {
+		t.Errorf("scratch source not extracted next to the render: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "d.png")); err != nil {
+		t.Errorf("scratch render missing: %v", err)
+	}
+	if _, err := os.Stat(genMMDDir); err == nil {
+		t.Errorf("a scratch render wrote into %s", genMMDDir)
+	}
+
+	if err := renderAll(cfg, genPNGDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(genMMDDir, "d.mmd")); err != nil {
+		t.Errorf("regular render did not extract into %s: %v", genMMDDir, err)
+	}
+}
@@ -0,0 +1,451 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// trimTolerance is the per-channel difference from the corner colour up to
+// which a pixel still counts as border background.
+const trimTolerance = 8
+
+// postProcessResult describes what postProcessPNG did to one file.
+type postProcessResult struct {
+	Before, After int64
+	Width, Height int
+	Trimmed       bool
+	Scaled        bool
+	Colors        int  // palette size when written as a paletted PNG, else 0
+	Lossy         bool // palette was quantised rather than exact
+}
+
+// atDensity converts the CSS-pixel margin into device pixels for an image
+// rendered at density device pixels per CSS pixel, so every output keeps the
+// same margin on the page whatever its resolution.
+func (pp postProcessConfig) atDensity(density float64) postProcessConfig {
+	pp.Margin = int(math.Round(float64(pp.Margin) * density))
+	return pp
+}
+
+// postProcessPNG trims, downscales and re-compresses a rendered PNG in place
+// according to pp. Like normalizePNG the output is re-encoded with fixed
+// settings and no ancillary chunks, so identical input gives identical bytes.
+// Non-PNG outputs are left alone.
+func postProcessPNG(path string, pp postProcessConfig) (postProcessResult, error) {
+	var res postProcessResult
+	if !strings.EqualFold(filepath.Ext(path), ".png") {
+		return res, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return res, err
+	}
+	decoded, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return res, fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	res.Before = int64(len(data))
+
+	img := toNRGBA(decoded)
+	if pp.Trim {
+		if trimmed := trimBorders(img, pp.Margin); trimmed != img {
+			img, res.Trimmed = trimmed, true
+		}
+	}
+	if pp.MaxWidth > 0 && img.Bounds().Dx() > pp.MaxWidth {
+		img, res.Scaled = resizeToWidth(img, pp.MaxWidth), true
+	}
+	res.Width, res.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+	out, colors, lossy, err := encodeSmallest(img, pp)
+	if err != nil {
+		return res, fmt.Errorf("failed to re-encode %s: %w", path, err)
+	}
+	res.After, res.Colors, res.Lossy = int64(len(out)), colors, lossy
+
+	if bytes.Equal(out, data) {
+		return res, nil
+	}
+	return res, os.WriteFile(path, out, 0644)
+}
+
+// String summarises the result for the render log.
+func (r postProcessResult) String() string {
+	s := fmt.Sprintf("%s → %s", formatBytes(r.Before), formatBytes(r.After))
+	if r.Before > 0 {
+		s += fmt.Sprintf(" (%+.0f%%)", 100*float64(r.After-r.Before)/float64(r.Before))
+	}
+	var notes []string
+	if r.Trimmed {
+		notes = append(notes, "trimmed")
+	}
+	if r.Scaled {
+		notes = append(notes, "scaled")
+	}
+	if r.Trimmed || r.Scaled {
+		notes[len(notes)-1] += fmt.Sprintf(" to %dx%d", r.Width, r.Height)
+	}
+	switch {
+	case r.Lossy:
+		notes = append(notes, fmt.Sprintf("quantised to %d colours", r.Colors))
+	case r.Colors > 0:
+		notes = append(notes, fmt.Sprintf("%d-colour palette", r.Colors))
+	}
+	if len(notes) > 0 {
+		s += ", " + strings.Join(notes, ", ")
+	}
+	return s
+}
+
+// toNRGBA returns img as an *image.NRGBA with its origin at (0, 0).
+func toNRGBA(img image.Image) *image.NRGBA {
+	b := img.Bounds()
+	if n, ok := img.(*image.NRGBA); ok && b.Min == (image.Point{}) {
+		return n
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			out.Set(x, y, img.At(b.Min.X+x, b.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// trimBorders crops the border that matches the top-left pixel's colour,
+// keeping margin pixels of it around the content. It returns img itself when
+// there is nothing to trim.
+func trimBorders(img *image.NRGBA, margin int) *image.NRGBA {
+	b := img.Bounds()
+	bg := img.NRGBAAt(b.Min.X, b.Min.Y)
+
+	content := image.Rectangle{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if channelDelta(img.NRGBAAt(x, y), bg) > trimTolerance {
+				content = content.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+	if content.Empty() {
+		return img
+	}
+
+	crop := content.Inset(-margin).Intersect(b)
+	if crop == b {
+		return img
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	for y := 0; y < crop.Dy(); y++ {
+		copy(out.Pix[y*out.Stride:y*out.Stride+crop.Dx()*4], img.Pix[img.PixOffset(crop.Min.X, crop.Min.Y+y):])
+	}
+	return out
+}
+
+// contrib is one source pixel's weight in a downscaled pixel.
+type contrib struct {
+	i int
+	w float64
+}
+
+// boxContribs returns, for each of dstN output pixels, the source pixels it
+// covers and how much of each (an area-averaging box filter).
+func boxContribs(srcN, dstN int) [][]contrib {
+	scale := float64(srcN) / float64(dstN)
+	out := make([][]contrib, dstN)
+	for d := range out {
+		lo, hi := float64(d)*scale, float64(d+1)*scale
+		for s := int(lo); s < srcN && float64(s) < hi; s++ {
+			if w := math.Min(hi, float64(s+1)) - math.Max(lo, float64(s)); w > 0 {
+				out[d] = append(out[d], contrib{s, w})
+			}
+		}
+	}
+	return out
+}
+
+// resizeToWidth downscales img to width w, keeping the aspect ratio. Colours
+// are averaged with premultiplied alpha so transparent edges do not darken.
+func resizeToWidth(img *image.NRGBA, w int) *image.NRGBA {
+	sw, sh := img.Bounds().Dx(), img.Bounds().Dy()
+	h := max(1, int(math.Round(float64(sh)*float64(w)/float64(sw))))
+	cols, rows := boxContribs(sw, w), boxContribs(sh, h)
+
+	// Horizontal pass into premultiplied float rows.
+	tmp := make([]float32, sh*w*4)
+	for y := 0; y < sh; y++ {
+		for dx, cs := range cols {
+			var r, g, b, a, total float64
+			for _, c := range cs {
+				p := img.NRGBAAt(c.i, y)
+				pa := float64(p.A) / 255
+				r += float64(p.R) * pa * c.w
+				g += float64(p.G) * pa * c.w
+				b += float64(p.B) * pa * c.w
+				a += float64(p.A) * c.w
+				total += c.w
+			}
+			o := (y*w + dx) * 4
+			tmp[o], tmp[o+1], tmp[o+2], tmp[o+3] = float32(r/total), float32(g/total), float32(b/total), float32(a/total)
+		}
+	}
+
+	// Vertical pass, then un-premultiply.
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for dy, rs := range rows {
+		for x := 0; x < w; x++ {
+			var r, g, b, a, total float64
+			for _, c := range rs {
+				o := (c.i*w + x) * 4
+				r += float64(tmp[o]) * c.w
+				g += float64(tmp[o+1]) * c.w
+				b += float64(tmp[o+2]) * c.w
+				a += float64(tmp[o+3]) * c.w
+				total += c.w
+			}
+			r, g, b, a = r/total, g/total, b/total, a/total
+			if a <= 0 {
+				continue
+			}
+			pa := a / 255
+			out.SetNRGBA(x, dy, color.NRGBA{R: clamp8(r / pa), G: clamp8(g / pa), B: clamp8(b / pa), A: clamp8(a)})
+		}
+	}
+	return out
+}
+
+// clamp8 rounds v into the 0-255 range.
+func clamp8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
+
+// encodeSmallest encodes img as truecolour and, when it has at most 256
+// colours (or pp.Quantize allows reducing them to pp.Colors), as a paletted
+// PNG, and returns the smaller. colors is the palette size used, 0 for truecolour.
+func encodeSmallest(img *image.NRGBA, pp postProcessConfig) (out []byte, colors int, lossy bool, err error) {
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+
+	var buf bytes.Buffer
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, 0, false, err
+	}
+	out = buf.Bytes()
+
+	limit := pp.Colors
+	if limit <= 0 || limit > 256 {
+		limit = 256
+	}
+	hist := colorHistogram(img, 256, pp.Quantize)
+
+	var pal color.Palette
+	switch {
+	case hist == nil:
+		return out, 0, false, nil
+	case pp.Quantize && len(hist) > limit:
+		pal, lossy = quantizePalette(hist, limit), true
+	case len(hist) <= 256:
+		for _, cc := range hist {
+			pal = append(pal, cc.c)
+		}
+	default:
+		return out, 0, false, nil
+	}
+
+	var pbuf bytes.Buffer
+	if err := enc.Encode(&pbuf, toPaletted(img, pal)); err != nil {
+		return nil, 0, false, err
+	}
+	if pbuf.Len() < len(out) {
+		return pbuf.Bytes(), len(pal), lossy, nil
+	}
+	return out, 0, false, nil
+}
+
+// colorCount is one distinct colour and the number of pixels using it.
+type colorCount struct {
+	c color.NRGBA
+	n int
+}
+
+// colorHistogram counts the distinct colours in img, sorted by value. Unless
+// full is set it gives up and returns nil once more than limit colours appear.
+func colorHistogram(img *image.NRGBA, limit int, full bool) []colorCount {
+	counts := map[uint32]int{}
+	for i := 0; i < len(img.Pix); i += 4 {
+		p := img.Pix[i : i+4 : i+4]
+		counts[uint32(p[0])<<24|uint32(p[1])<<16|uint32(p[2])<<8|uint32(p[3])]++
+		if !full && len(counts) > limit {
+			return nil
+		}
+	}
+
+	keys := make([]uint32, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	hist := make([]colorCount, len(keys))
+	for i, k := range keys {
+		hist[i] = colorCount{color.NRGBA{R: uint8(k >> 24), G: uint8(k >> 16), B: uint8(k >> 8), A: uint8(k)}, counts[k]}
+	}
+	return hist
+}
+
+// quantizePalette reduces hist to at most k colours with medianCut. Fully
+// transparent colours are kept out of the cut and share one transparent entry,
+// so averaging never makes invisible pixels visible.
+func quantizePalette(hist []colorCount, k int) color.Palette {
+	visible := make([]colorCount, 0, len(hist))
+	for _, cc := range hist {
+		if cc.c.A != 0 {
+			visible = append(visible, cc)
+		}
+	}
+	if len(visible) == len(hist) || k < 2 {
+		return medianCut(hist, k)
+	}
+	if len(visible) == 0 {
+		return color.Palette{color.NRGBA{}}
+	}
+	return append(medianCut(visible, k-1), color.NRGBA{})
+}
+
+// medianCut reduces hist to at most k colours: it repeatedly splits the box
+// with the widest channel range at its pixel-weighted median, then uses each
+// box's weighted average. Sorting is stable, so the palette is deterministic.
+func medianCut(hist []colorCount, k int) color.Palette {
+	channel := func(c color.NRGBA, ch int) int {
+		return int([4]uint8{c.R, c.G, c.B, c.A}[ch])
+	}
+	widest := func(box []colorCount) (ch, span int) {
+		for c := 0; c < 4; c++ {
+			lo, hi := 255, 0
+			for _, cc := range box {
+				v := channel(cc.c, c)
+				lo, hi = min(lo, v), max(hi, v)
+			}
+			if hi-lo > span {
+				ch, span = c, hi-lo
+			}
+		}
+		return ch, span
+	}
+
+	boxes := [][]colorCount{hist}
+	for len(boxes) < k {
+		best, bestSpan, bestCh := -1, 0, 0
+		for i, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			if ch, span := widest(box); span > bestSpan {
+				best, bestSpan, bestCh = i, span, ch
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		box := boxes[best]
+		sort.SliceStable(box, func(i, j int) bool { return channel(box[i].c, bestCh) < channel(box[j].c, bestCh) })
+		total := 0
+		for _, cc := range box {
+			total += cc.n
+		}
+		split, seen := 1, 0
+		for i, cc := range box[:len(box)-1] {
+			seen += cc.n
+			if seen*2 >= total {
+				split = i + 1
+				break
+			}
+		}
+		boxes = append(boxes[:best], append([][]colorCount{box[:split], box[split:]}, boxes[best+1:]...)...)
+	}
+
+	pal := make(color.Palette, 0, len(boxes))
+	for _, box := range boxes {
+		var r, g, b, a, n float64
+		for _, cc := range box {
+			w := float64(cc.n)
+			r, g, b, a, n = r+float64(cc.c.R)*w, g+float64(cc.c.G)*w, b+float64(cc.c.B)*w, a+float64(cc.c.A)*w, n+w
+		}
+		pal = append(pal, color.NRGBA{R: clamp8(r / n), G: clamp8(g / n), B: clamp8(b / n), A: clamp8(a / n)})
+	}
+	return pal
+}
+
+// toPaletted maps every pixel to its nearest palette entry.
+func toPaletted(img *image.NRGBA, pal color.Palette) *image.Paletted {
+	b := img.Bounds()
+	out := image.NewPaletted(b, pal)
+	cache := map[color.NRGBA]uint8{}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := img.NRGBAAt(x, y)
+			idx, ok := cache[c]
+			if !ok {
+				idx = uint8(nearestNRGBA(pal, c))
+				cache[c] = idx
+			}
+			out.SetColorIndex(x, y, idx)
+		}
+	}
+	return out
+}
+
+// nearestNRGBA returns the index of the palette entry closest to c, comparing
+// non-premultiplied channels (palette.Index would compare premultiplied ones).
+// A fully transparent c only matches fully transparent entries when the
+// palette has any, so it never picks up colour.
+func nearestNRGBA(pal color.Palette, c color.NRGBA) int {
+	transparentOnly := false
+	if c.A == 0 {
+		for _, p := range pal {
+			if p.(color.NRGBA).A == 0 {
+				transparentOnly = true
+				break
+			}
+		}
+	}
+
+	best, bestDist := 0, math.MaxInt
+	for i, p := range pal {
+		q := p.(color.NRGBA)
+		if transparentOnly && q.A != 0 {
+			continue
+		}
+		dr, dg, db, da := int(c.R)-int(q.R), int(c.G)-int(q.G), int(c.B)-int(q.B), int(c.A)-int(q.A)
+		if d := dr*dr + dg*dg + db*db + da*da; d < bestDist {
+			best, bestDist = i, d
+			if d == 0 {
+				break
+			}
+		}
+	}
+	return best
+}
+
+// formatBytes renders a byte count for logs.
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,136 @@
+//go:build mage
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// mustWritePNG encodes img to path.
+func mustWritePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	if err := writePNG(path, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// mustReadPNG decodes the PNG at path.
+func mustReadPNG(t *testing.T, path string) image.Image {
+	t.Helper()
+	img, err := readPNG(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func TestTrimBordersKeepsMargin(t *testing.T) {
+	// A 20×10 block on a 100×60 white canvas with faint near-white noise.
+	img := solidImage(100, 60, color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}, map[image.Point]color.NRGBA{
+		{2, 2}: {0xFA, 0xFA, 0xFA, 0xFF}, {97, 57}: {0xF8, 0xFF, 0xFF, 0xFF},
+	})
+	for y := 25; y < 35; y++ {
+		for x := 40; x < 60; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{A: 0xFF})
+		}
+	}
+
+	for _, tc := range []struct {
+		margin, w, h int
+	}{
+		{0, 20, 10},
+		{5, 30, 20},
+		{30, 80, 60}, // clipped to the canvas vertically
+	} {
+		out := trimBorders(img, tc.margin)
+		if b := out.Bounds(); b.Dx() != tc.w || b.Dy() != tc.h || b.Min != (image.Point{}) {
+			t.Errorf("margin %d: trimmed to %v, want %dx%d at the origin", tc.margin, b, tc.w, tc.h)
+			continue
+		}
+		if got := out.NRGBAAt(min(tc.margin, 40), min(tc.margin, 25)); got.A != 0xFF || got.R != 0 {
+			t.Errorf("margin %d: content corner is %v, want black", tc.margin, got)
+		}
+	}
+	if out := trimBorders(img, 100); out != img {
+		t.Error("a margin larger than the border still produced a copy")
+	}
+}
+
+func TestPostProcessDownscaleKeepsAspect(t *testing.T) {
+	for _, size := range []image.Point{{300, 100}, {301, 97}, {1000, 7}, {640, 480}} {
+		path := filepath.Join(t.TempDir(), "d.png")
+		img := solidImage(size.X, size.Y, color.NRGBA{0x20, 0x40, 0x80, 0xFF}, nil)
+		mustWritePNG(t, path, img)
+
+		res, err := postProcessPNG(path, postProcessConfig{MaxWidth: 120})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := mustReadPNG(t, path).Bounds()
+		if !res.Scaled || b.Dx() != 120 || res.Width != 120 || res.Height != b.Dy() {
+			t.Errorf("%v: scaled to %v (%+v), want width 120", size, b, res)
+			continue
+		}
+		if want := float64(size.Y) * 120 / float64(size.X); math.Abs(float64(b.Dy())-want) > 0.5 && b.Dy() != 1 {
+			t.Errorf("%v: height %d, want %.1f to keep the aspect ratio", size, b.Dy(), want)
+		}
+	}
+
+	// Narrower images are left at their size.
+	path := filepath.Join(t.TempDir(), "d.png")
+	mustWritePNG(t, path, solidImage(100, 50, color.NRGBA{A: 0xFF}, nil))
+	if res, err := postProcessPNG(path, postProcessConfig{MaxWidth: 120}); err != nil || res.Scaled || res.Width != 100 {
+		t.Errorf("narrow image: %+v, %v", res, err)
+	}
+}
+
+func TestPostProcessQuantize(t *testing.T) {
+	// Thousands of noisy colours, so a palette beats truecolour, with a fully
+	// transparent stripe whose hidden RGB varies.
+	img := image.NewNRGBA(image.Rect(0, 0, 64, 64))
+	seed := uint32(1)
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 64; x++ {
+			seed = seed*1664525 + 1013904223
+			c := color.NRGBA{uint8(seed >> 24), uint8(seed >> 16), uint8(seed >> 8), 0xFF}
+			if x >= 56 {
+				c = color.NRGBA{uint8(seed >> 24), uint8(seed >> 16), 0x20, 0x00}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	for _, colors := range []int{2, 16, 64} {
+		path := filepath.Join(t.TempDir(), "d.png")
+		mustWritePNG(t, path, img)
+		res, err := postProcessPNG(path, postProcessConfig{Quantize: true, Colors: colors})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Lossy || res.Colors > colors {
+			t.Errorf("colors %d: %+v, want a lossy palette of at most %d", colors, res, colors)
+		}
+
+		out := mustReadPNG(t, path)
+		if p, ok := out.(*image.Paletted); !ok || len(p.Palette) > colors {
+			t.Errorf("colors %d: decoded as %T, want a palette of at most %d entries", colors, out, colors)
+		}
+		seen := map[color.NRGBA]bool{}
+		for y := 0; y < 64; y++ {
+			for x := 0; x < 64; x++ {
+				c := color.NRGBAModel.Convert(out.At(x, y)).(color.NRGBA)
+				seen[c] = true
+				if transparent := x >= 56; transparent != (c.A == 0) {
+					t.Fatalf("colors %d: pixel (%d,%d) has alpha %d, want transparent=%v", colors, x, y, c.A, transparent)
+				}
+			}
+		}
+		if len(seen) > colors {
+			t.Errorf("colors %d: %d distinct colours in the output", colors, len(seen))
+		}
+	}
+}
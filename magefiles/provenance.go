@@ -0,0 +1,342 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// provenanceNS is the XML namespace of the SVG <metadata> provenance elements.
+const provenanceNS = "https://github.com/henryhall897/wiki-diagrams/provenance"
+
+// pngSignature starts every PNG file.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// provenance records what produced a rendered image.
+type provenance struct {
+	Source       string
+	SourceSHA256 string
+	Commit       string
+	Renderer     string
+	Theme        string
+}
+
+// fields returns the metadata keys and values in a stable order. PNG iTXt
+// chunks use the keys as-is, SVG elements their lower-case form.
+func (p provenance) fields() [][2]string {
+	return [][2]string{
+		{"Source", p.Source},
+		{"Source-SHA256", p.SourceSHA256},
+		{"Commit", p.Commit},
+		{"Renderer", p.Renderer},
+		{"Theme", p.Theme},
+	}
+}
+
+// rendererVersions caches each renderer's version for the rest of the run.
+var rendererVersions = map[string]string{}
+
+// diagramProvenance collects the provenance of a diagram rendered from mdPath.
+// The commit is the last one that touched the source (marked -dirty when it
+// has uncommitted changes), so re-rendering an unchanged diagram keeps its
+// bytes stable across unrelated commits.
+func diagramProvenance(mdPath string, r diagramRenderer, themeName string) (provenance, error) {
+	sum, err := fileSHA256(mdPath)
+	if err != nil {
+		return provenance{}, err
+	}
+
+	version, ok := rendererVersions[r.fence]
+	if !ok {
+		version = "unknown"
+		if out, err := r.version(); err == nil {
+			version = out
+			if v, err := extractVersion(out); err == nil {
+				version = v
+			}
+		}
+		rendererVersions[r.fence] = version
+	}
+
+	return provenance{
+		Source:       filepath.ToSlash(mdPath),
+		SourceSHA256: sum,
+		Commit:       sourceCommit(mdPath),
+		Renderer:     r.tool + " " + version,
+		Theme:        themeName,
+	}, nil
+}
+
+// sourceCommit returns the last commit touching path, "uncommitted" for new
+// files, or "unknown" outside a git checkout.
+func sourceCommit(path string) string {
+	out, err := exec.Command("git", "log", "-1", "--format=%H", "--", path).Output()
+	if err != nil {
+		return "unknown"
+	}
+	commit := strings.TrimSpace(string(out))
+	if commit == "" {
+		return "uncommitted"
+	}
+	if status, _ := exec.Command("git", "status", "--porcelain", "--", path).Output(); len(bytes.TrimSpace(status)) > 0 {
+		commit += "-dirty"
+	}
+	return commit
+}
+
+// stampProvenance writes p into a rendered image: iTXt chunks for PNG, a
+// <metadata> element for SVG. Earlier stamps are replaced. Other formats are
+// left alone.
+func stampProvenance(path string, p provenance) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return stampPNG(path, p)
+	case ".svg":
+		return stampSVG(path, p)
+	}
+	return nil
+}
+
+// pngChunk is one chunk of a PNG stream.
+type pngChunk struct {
+	Type string
+	Data []byte
+}
+
+// readPNGChunks splits a PNG file into its chunks.
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errors.New("not a PNG file")
+	}
+	var chunks []pngChunk
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		if len(rest) < 12 {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		n := binary.BigEndian.Uint32(rest[:4])
+		if uint64(len(rest)) < 12+uint64(n) {
+			return nil, errors.New("truncated PNG chunk")
+		}
+		chunks = append(chunks, pngChunk{Type: string(rest[4:8]), Data: rest[8 : 8+n]})
+		rest = rest[12+n:]
+	}
+	return chunks, nil
+}
+
+// writePNGChunk appends a chunk with its length and CRC.
+func writePNGChunk(buf *bytes.Buffer, c pngChunk) {
+	binary.Write(buf, binary.BigEndian, uint32(len(c.Data)))
+	buf.WriteString(c.Type)
+	buf.Write(c.Data)
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(c.Type))
+	crc.Write(c.Data)
+	binary.Write(buf, binary.BigEndian, crc.Sum32())
+}
+
+// stampPNG inserts the provenance as iTXt chunks right after IHDR, dropping
+// any text chunks that already use the same keywords. iTXt carries UTF-8,
+// where tEXt is limited to Latin-1, so non-ASCII source paths survive.
+func stampPNG(path string, p provenance) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	keys := map[string]bool{}
+	for _, f := range p.fields() {
+		keys[f[0]] = true
+	}
+
+	var buf bytes.Buffer
+	buf.Write(pngSignature)
+	for _, c := range chunks {
+		if c.Type == "tEXt" || c.Type == "iTXt" {
+			if key, _, _ := bytes.Cut(c.Data, []byte{0}); keys[string(key)] {
+				continue
+			}
+		}
+		writePNGChunk(&buf, c)
+		if c.Type == "IHDR" {
+			for _, f := range p.fields() {
+				writePNGChunk(&buf, pngChunk{Type: "iTXt", Data: iTXtData(f[0], f[1])})
+			}
+		}
+	}
+	return os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// iTXtData encodes an uncompressed iTXt chunk with no language tag or
+// translated keyword.
+func iTXtData(key, value string) []byte {
+	// keyword NUL, compression flag and method, empty language tag NUL,
+	// empty translated keyword NUL, text.
+	return []byte(key + "\x00" + "\x00\x00" + "\x00" + "\x00" + value)
+}
+
+// parseITXt decodes an iTXt chunk. Compressed text is not supported, since
+// stampPNG never writes it.
+func parseITXt(data []byte) (key, value string, err error) {
+	k, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok || len(rest) < 2 {
+		return "", "", errors.New("malformed iTXt chunk")
+	}
+	if rest[0] != 0 {
+		return "", "", fmt.Errorf("compressed iTXt chunk %q", k)
+	}
+	// Skip the language tag and translated keyword.
+	rest = rest[2:]
+	for i := 0; i < 2; i++ {
+		var found bool
+		if _, rest, found = bytes.Cut(rest, []byte{0}); !found {
+			return "", "", errors.New("malformed iTXt chunk")
+		}
+	}
+	return string(k), string(rest), nil
+}
+
+// latin1 decodes tEXt chunk text, which is Latin-1 rather than UTF-8.
+func latin1(b []byte) string {
+	r := make([]rune, len(b))
+	for i, c := range b {
+		r[i] = rune(c)
+	}
+	return string(r)
+}
+
+// readPNGText returns a PNG's tEXt and iTXt keyword/value pairs in file order.
+func readPNGText(path string) ([][2]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var fields [][2]string
+	for _, c := range chunks {
+		switch c.Type {
+		case "tEXt":
+			key, value, _ := bytes.Cut(c.Data, []byte{0})
+			fields = append(fields, [2]string{latin1(key), latin1(value)})
+		case "iTXt":
+			key, value, err := parseITXt(c.Data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			fields = append(fields, [2]string{key, value})
+		}
+	}
+	return fields, nil
+}
+
+// svgProvenancePattern matches a previously stamped metadata block.
+var svgProvenancePattern = regexp.MustCompile(`(?s)<metadata id="wiki-diagrams-provenance">.*?</metadata>`)
+
+// stampSVG inserts the provenance as a <metadata> element directly inside
+// the root <svg> element, replacing an earlier stamp.
+func stampSVG(path string, p provenance) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	data = svgProvenancePattern.ReplaceAll(data, nil)
+
+	start := bytes.Index(data, []byte("<svg"))
+	if start < 0 {
+		return fmt.Errorf("%s: no <svg> element", path)
+	}
+	end := bytes.IndexByte(data[start:], '>')
+	if end < 0 {
+		return fmt.Errorf("%s: unterminated <svg> element", path)
+	}
+	end += start + 1
+
+	var meta bytes.Buffer
+	meta.WriteString(`<metadata id="wiki-diagrams-provenance"><wd:provenance xmlns:wd="` + provenanceNS + `">`)
+	for _, f := range p.fields() {
+		name := strings.ToLower(f[0])
+		meta.WriteString("<wd:" + name + ">")
+		xml.EscapeText(&meta, []byte(f[1]))
+		meta.WriteString("</wd:" + name + ">")
+	}
+	meta.WriteString("</wd:provenance></metadata>")
+
+	out := append(append(append([]byte{}, data[:end]...), meta.Bytes()...), data[end:]...)
+	return os.WriteFile(path, out, 0644)
+}
+
+// readSVGProvenance returns the provenance elements of an SVG in file order.
+func readSVGProvenance(path string) ([][2]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var fields [][2]string
+	dec := xml.NewDecoder(f)
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return fields, nil
+			}
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Space != provenanceNS || start.Name.Local == "provenance" {
+			continue
+		}
+		var value string
+		if err := dec.DecodeElement(&value, &start); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		fields = append(fields, [2]string{start.Name.Local, value})
+	}
+}
+
+// Inspect prints the provenance metadata embedded in a rendered PNG or SVG.
+func (Diagrams) Inspect(file string) error {
+	var fields [][2]string
+	var err error
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".png":
+		fields, err = readPNGText(file)
+	case ".svg":
+		fields, err = readSVGProvenance(file)
+	default:
+		return fmt.Errorf("unsupported image type: %s (expected .png or .svg)", file)
+	}
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("no provenance metadata in %s — re-render it with mage diagrams:renderAll", file)
+	}
+
+	fmt.Printf("🔎 %s\n", file)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, f := range fields {
+		fmt.Fprintf(w, "   %s\t%s\n", f[0], f[1])
+	}
+	return w.Flush()
+}
@@ -0,0 +1,110 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStampedPNGProvenanceRoundTrips(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "d.png")
+	mustWritePNG(t, path, solidImage(4, 4, color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}, nil))
+	// A stale Latin-1 stamp must be replaced, not duplicated.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, withChunk(data, "tEXt", []byte("Source\x00caf\xe9.md")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := provenance{
+		Source:       "src/Übersicht — 网络.md",
+		SourceSHA256: strings.Repeat("ab", 32),
+		Commit:       "0123abc-dirty",
+		Renderer:     "mermaid-cli 11.4.2",
+		Theme:        "navy",
+	}
+	if err := stampProvenance(path, p); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err = os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readPNG(path); err != nil {
+		t.Fatalf("stamped PNG no longer decodes: %v", err)
+	}
+
+	// Walk the raw chunks: every CRC must match and the provenance must sit
+	// directly after IHDR.
+	var types []string
+	for rest := data[len(pngSignature):]; len(rest) > 0; {
+		n := binary.BigEndian.Uint32(rest[:4])
+		body := rest[4 : 8+n]
+		if got, want := binary.BigEndian.Uint32(rest[8+n:12+n]), crc32.ChecksumIEEE(body); got != want {
+			t.Errorf("%s chunk CRC = %08x, want %08x", body[:4], got, want)
+		}
+		types = append(types, string(body[:4]))
+		rest = rest[12+n:]
+	}
+	want := []string{"IHDR", "iTXt", "iTXt", "iTXt", "iTXt", "iTXt"}
+	if len(types) < len(want) || strings.Join(types[:len(want)], ",") != strings.Join(want, ",") {
+		t.Errorf("chunk order = %v, want provenance right after IHDR", types)
+	}
+	if bytes.Contains(data, []byte("tEXt")) {
+		t.Error("stale tEXt stamp was kept")
+	}
+
+	out := filepath.Join(dir, "inspect.txt")
+	f, err := os.Create(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = f
+	err = (Diagrams{}).Inspect(path)
+	os.Stdout = stdout
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range p.fields() {
+		if !strings.Contains(string(printed), field[0]+"  ") || !strings.Contains(string(printed), field[1]) {
+			t.Errorf("Inspect output lacks %s = %q:\n%s", field[0], field[1], printed)
+		}
+	}
+}
+
+func TestReadPNGTextDecodesLatin1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "d.png")
+	mustWritePNG(t, path, solidImage(4, 4, color.NRGBA{A: 0xFF}, nil))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, withChunk(data, "tEXt", []byte("Source\x00caf\xe9.md")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fields, err := readPNGText(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fields) != 1 || fields[0] != [2]string{"Source", "café.md"} {
+		t.Errorf("readPNGText = %q, want [[Source café.md]]", fields)
+	}
+}
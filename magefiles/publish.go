@@ -0,0 +1,76 @@
+//go:build mage
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/magefile/mage/mg"
+)
+
+// Publish namespace groups tasks that deliver rendered diagrams to the wiki.
+type Publish mg.Namespace
+
+// WikiJS uploads every rendered image to a Wiki.js instance through its asset API.
+// The base URL and folder come from diagrams.json (or WIKIJS_URL); the API
+// token is read from WIKIJS_API_TOKEN and never stored in the repo.
+func (Publish) WikiJS() error {
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+
+	baseURL := cfg.Publish.WikiJS.URL
+	if env := os.Getenv("WIKIJS_URL"); env != "" {
+		baseURL = env
+	}
+	token := os.Getenv("WIKIJS_API_TOKEN")
+	if baseURL == "" {
+		return errors.New("❌ Wiki.js URL not configured — set publish.wikijs.url in diagrams.json or WIKIJS_URL")
+	}
+	if token == "" {
+		return errors.New("❌ WIKIJS_API_TOKEN is not set — create an API key under Wiki.js Administration → API Access")
+	}
+
+	files, err := filepath.Glob(filepath.Join(genPNGDir, "*."+outputExt))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no rendered diagrams found in %s — run mage diagrams:renderAll first", genPNGDir)
+	}
+
+	fmt.Printf("🚀 Publishing %d diagrams to %s (folder: /%s)\n", len(files), baseURL, cfg.Publish.WikiJS.Folder)
+	client := newWikiJSClient(baseURL, token)
+
+	folderID, err := client.ensureFolderPath(cfg.Publish.WikiJS.Folder)
+	if err != nil {
+		return err
+	}
+	existing, err := client.assets(folderID)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(existing))
+	for _, a := range existing {
+		known[a.Filename] = true
+	}
+
+	for _, path := range files {
+		name := filepath.Base(path)
+		action := "Uploading"
+		if known[name] {
+			action = "Replacing"
+		}
+		fmt.Printf("→ %s %s\n", action, name)
+		if err := client.upload(folderID, path); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("✅ Published %d diagrams to Wiki.js.\n", len(files))
+	return nil
+}
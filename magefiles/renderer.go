@@ -0,0 +1,245 @@
+//go:build mage
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// rendererImage is the tag Docker.BuildRenderer builds and container rendering runs.
+var rendererImage = "wiki-diagrams-renderer:" + TargetMermaidVersion
+
+// rendererDockerfile is the Dockerfile for the renderer image.
+const rendererDockerfile = "docker/renderer.Dockerfile"
+
+// TargetNodeVersion is the Node release copied into the renderer image.
+const TargetNodeVersion = "22.20.0"
+
+// The renderer image's base, and the table pinning every base image by digest.
+const (
+	rendererBaseImage     = "ubuntu:24.04"
+	rendererImagePinsPath = "docker/base-images.digests"
+)
+
+// rendererBaseDistro describes rendererBaseImage, so the Chromium packages
+// installed in the image come from the same mapping VerifySystemLibs uses.
+var rendererBaseDistro = distro{ID: "ubuntu", Like: []string{"debian"}, VersionID: "24.04", Name: "Ubuntu 24.04"}
+
+// imageDigestPattern matches the digests stored in rendererImagePinsPath.
+var imageDigestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// rendererBaseImages lists the images the Dockerfile builds from, keyed by
+// the build argument that receives each pinned reference.
+func rendererBaseImages() [][2]string {
+	return [][2]string{
+		{"GO_IMAGE", "golang:" + TargetGoVersion},
+		{"NODE_IMAGE", "node:" + TargetNodeVersion + "-bookworm-slim"},
+		{"BASE_IMAGE", rendererBaseImage},
+	}
+}
+
+// Project-local Node tooling: tools/package.json and its lockfile pin mmdc
+// and its transitive dependencies.
+const (
+	toolsDir      = "tools"
+	toolsLockfile = "tools/package-lock.json"
+	localMMDCBin  = "tools/node_modules/.bin/mmdc"
+)
+
+// Renderer modes for mmdc.
+const (
+	rendererHost      = "host"
+	rendererContainer = "container"
+)
+
+// rendererMode returns where mmdc runs: DIAGRAMS_RENDERER, then the
+// "renderer" setting in diagrams.json, defaulting to the host.
+func rendererMode() string {
+	if env := os.Getenv("DIAGRAMS_RENDERER"); env != "" {
+		return env
+	}
+	if cfg, err := loadProjectConfig(); err == nil && cfg.Renderer != "" {
+		return cfg.Renderer
+	}
+	return rendererHost
+}
+
+// mmdcCommand builds an mmdc invocation on the host or inside the renderer
+// image, see rendererCommand.
+func mmdcCommand(args ...string) (*exec.Cmd, error) {
+	return rendererCommand(hostMMDC(), "mmdc", args...)
+}
+
+// rendererCommand builds a command that runs hostBin on the host or imageBin
+// inside the renderer image. In container mode the repo is mounted at /work so
+// the relative paths used throughout the magefiles resolve the same way, and
+// stdin is passed through. When the bundled fonts are installed,
+// FONTCONFIG_FILE points at them.
+func rendererCommand(hostBin, imageBin string, args ...string) (*exec.Cmd, error) {
+	fontconfig := privateFontconfig()
+
+	switch mode := rendererMode(); mode {
+	case rendererHost:
+		return hostCommand(hostBin, args...)
+	case rendererContainer:
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		dockerArgs := []string{
+			"run", "--rm", "-i",
+			"-v", wd + ":/work",
+			"-w", "/work",
+			"-u", fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid()),
+		}
+		if fontconfig != "" {
+			dockerArgs = append(dockerArgs, "-e", "FONTCONFIG_FILE=/work/"+filepath.ToSlash(fontconfig))
+		}
+		dockerArgs = append(dockerArgs, rendererImage, imageBin)
+		return exec.Command(dockerBin(), append(dockerArgs, args...)...), nil
+	default:
+		return nil, fmt.Errorf("unknown renderer %q (expected %s or %s)", mode, rendererHost, rendererContainer)
+	}
+}
+
+// hostCommand runs bin on the host with the private fontconfig, if installed.
+func hostCommand(bin string, args ...string) (*exec.Cmd, error) {
+	cmd := exec.Command(bin, args...)
+	if fontconfig := privateFontconfig(); fontconfig != "" {
+		abs, err := filepath.Abs(fontconfig)
+		if err != nil {
+			return nil, err
+		}
+		cmd.Env = append(os.Environ(), "FONTCONFIG_FILE="+abs)
+	}
+	return cmd, nil
+}
+
+// hostMMDC returns the mmdc to run on this machine: MMDC_BIN (set inside the
+// renderer image, so a bind-mounted host tools/ never shadows the image's
+// copy), then the project-local mmdc installed by Mermaid.Deps, then mmdc on PATH.
+func hostMMDC() string {
+	if bin := os.Getenv("MMDC_BIN"); bin != "" {
+		return bin
+	}
+	if _, err := os.Stat(localMMDCBin); err == nil {
+		return localMMDCBin
+	}
+	return "mmdc"
+}
+
+// rendererImageExists reports whether the renderer image is present locally.
+func rendererImageExists() bool {
+	return exec.Command(dockerBin(), "image", "inspect", rendererImage).Run() == nil
+}
+
+// BuildRenderer builds the pinned renderer image (Node, mmdc at
+// TargetMermaidVersion, Chromium and fonts, plus Go and mage for Docker.Run)
+// from docker/renderer.Dockerfile.
+func (Docker) BuildRenderer() error {
+	fmt.Printf("🐋 Building renderer image %s...\n", rendererImage)
+
+	if err := verifyDockerEngine(); err != nil {
+		return err
+	}
+	if err := checkToolsLockfile(); err != nil {
+		return err
+	}
+	buildArgs, err := rendererBuildArgs()
+	if err != nil {
+		return err
+	}
+	args := append([]string{"buildx", "build", "--load", "-t", rendererImage, "-f", rendererDockerfile}, buildArgs...)
+	if err := dockerRun(append(args, "--build-context", "tools="+toolsDir, "docker")...); err != nil {
+		return fmt.Errorf("failed to build renderer image: %w", err)
+	}
+
+	out, err := dockerOutput("run", "--rm", rendererImage, "mmdc", "--version")
+	if err != nil {
+		return fmt.Errorf("renderer image built but mmdc does not run: %w", err)
+	}
+	if _, err := checkToolVersion("Renderer image mmdc", out, MermaidVersionRequired, MermaidVersionRecommended); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Renderer image %s ready (mmdc %s).\n", rendererImage, out)
+	return nil
+}
+
+// rendererBuildArgs returns the --build-arg flags for the renderer image: the
+// pinned versions, every base image by digest from rendererImagePinsPath, and
+// the Chromium library packages for rendererBaseDistro.
+func rendererBuildArgs() ([]string, error) {
+	pins, err := readChecksumTable(rendererImagePinsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"--build-arg", "MERMAID_VERSION=" + TargetMermaidVersion,
+		"--build-arg", "NODE_VERSION=" + TargetNodeVersion,
+		"--build-arg", "D2_VERSION=" + TargetD2Version,
+	}
+	for _, img := range rendererBaseImages() {
+		digest, ok := pins[img[1]]
+		if !ok {
+			return nil, fmt.Errorf("%s is not pinned in %s — run mage docker:pinImages and commit it", img[1], rendererImagePinsPath)
+		}
+		if !imageDigestPattern.MatchString(digest) {
+			return nil, fmt.Errorf("%s has malformed digest %q in %s — run mage docker:pinImages and commit it", img[1], digest, rendererImagePinsPath)
+		}
+		args = append(args, "--build-arg", img[0]+"="+img[1]+"@"+digest)
+	}
+
+	sonames := make([]string, 0, len(chromiumLibs))
+	for soname := range chromiumLibs {
+		sonames = append(sonames, soname)
+	}
+	sort.Strings(sonames)
+	pkgs, unknown := rendererBaseDistro.packagesFor(sonames)
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("no %s package known for %s", rendererBaseDistro.Name, strings.Join(unknown, ", "))
+	}
+	sort.Strings(pkgs)
+	return append(args, "--build-arg", "CHROMIUM_PACKAGES="+strings.Join(pkgs, " ")), nil
+}
+
+// PinImages resolves the renderer's base images to their current registry
+// digests and rewrites docker/base-images.digests. Run it after bumping
+// TargetGoVersion, TargetNodeVersion or the Ubuntu base, and commit the result.
+func (Docker) PinImages() error {
+	fmt.Println("📌 Pinning renderer base images...")
+
+	var b strings.Builder
+	b.WriteString(rendererImagePinsHeader)
+	for _, img := range rendererBaseImages() {
+		digest, err := dockerOutput("buildx", "imagetools", "inspect", "--format", "{{.Manifest.Digest}}", img[1])
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", img[1], err)
+		}
+		if !imageDigestPattern.MatchString(digest) {
+			return fmt.Errorf("unexpected digest %q for %s", digest, img[1])
+		}
+		fmt.Fprintf(&b, "%s  %s\n", digest, img[1])
+		fmt.Printf("   %s  %s\n", digest, img[1])
+	}
+	if err := os.WriteFile(rendererImagePinsPath, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	fmt.Println("✅ Updated", rendererImagePinsPath)
+	return nil
+}
+
+// rendererImagePinsHeader is written at the top of the image digest table.
+const rendererImagePinsHeader = `# Registry digests of the renderer image's base images (multi-arch index digests).
+# Docker.BuildRenderer builds every stage FROM image@digest and refuses images
+# that are not listed here.
+# Regenerate with: mage docker:pinImages
+# Format: <digest>  <image>
+`
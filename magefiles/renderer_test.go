@@ -0,0 +1,80 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRendererImagePins(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll("docker", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(rendererImagePinsPath, []byte(rendererImagePinsHeader), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fakeDocker(t, nil, nil)
+
+	if _, err := rendererBuildArgs(); err == nil || !strings.Contains(err.Error(), "golang:"+TargetGoVersion+" is not pinned") {
+		t.Fatalf("build args without pins: error = %v", err)
+	}
+
+	if err := (Docker{}).PinImages(); err != nil {
+		t.Fatal(err)
+	}
+	pins, err := readChecksumTable(rendererImagePinsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pins) != 3 || !imageDigestPattern.MatchString(pins[rendererBaseImage]) {
+		t.Fatalf("pins = %v", pins)
+	}
+
+	args, err := rendererBuildArgs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := map[string]string{}
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] != "--build-arg" {
+			t.Fatalf("unexpected flag %q in %v", args[i], args)
+		}
+		name, value, _ := strings.Cut(args[i+1], "=")
+		values[name] = value
+	}
+	for _, img := range rendererBaseImages() {
+		ref, digest, _ := strings.Cut(values[img[0]], "@")
+		if ref != img[1] || !imageDigestPattern.MatchString(digest) || digest != pins[img[1]] {
+			t.Errorf("%s = %q, want %s@%s", img[0], values[img[0]], img[1], pins[img[1]])
+		}
+	}
+	if !strings.HasPrefix(values["NODE_IMAGE"], "node:"+TargetNodeVersion+"-bookworm-slim@sha256:") || values["NODE_VERSION"] != TargetNodeVersion {
+		t.Errorf("Node is not pinned: NODE_IMAGE=%q NODE_VERSION=%q", values["NODE_IMAGE"], values["NODE_VERSION"])
+	}
+
+	// Digests that are not sha256:<64 hex> are refused.
+	table := rendererImagePinsHeader
+	for _, img := range rendererBaseImages() {
+		table += "sha256:" + strings.Repeat("ab", 32) + "  " + img[1] + "\n"
+	}
+	if err := os.WriteFile(rendererImagePinsPath, []byte(strings.Replace(table, strings.Repeat("ab", 32), "latest", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rendererBuildArgs(); err == nil || !strings.Contains(err.Error(), "malformed digest") {
+		t.Errorf("malformed digest: error = %v", err)
+	}
+
+	pkgs := strings.Fields(values["CHROMIUM_PACKAGES"])
+	for _, want := range []string{"libasound2t64", "libgtk-3-0t64", "libnss3", "libgbm1"} {
+		if !slices.Contains(pkgs, want) {
+			t.Errorf("CHROMIUM_PACKAGES lacks %s: %v", want, pkgs)
+		}
+	}
+	if slices.Contains(pkgs, "libasound2") || !slices.IsSorted(pkgs) {
+		t.Errorf("CHROMIUM_PACKAGES = %v, want the sorted Ubuntu 24.04 (t64) names", pkgs)
+	}
+}
@@ -0,0 +1,189 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// sizesDir holds the high-density renders sizes are resampled from.
+const sizesDir = "build/sizes"
+
+// sizedOutput is one resolution written by writeSizes.
+type sizedOutput struct {
+	Size          sizeConfig
+	Path          string
+	Width, Height int
+	Density       float64 // device pixels per CSS pixel actually achieved
+}
+
+// sizeMaster returns the image the sizes are resampled from and its density.
+// The regular render at outPath is used when it is dense enough. Renderers
+// that can render at a chosen density (Mermaid) render again at the largest
+// density a size asks for, so puppeteer-config.json keeps its own
+// deviceScaleFactor for the main image.
+func sizeMaster(r diagramRenderer, srcPath, outPath string, t theme, sizes []sizeConfig, pp postProcessConfig) (string, float64, error) {
+	native := nativeScale(r)
+	if r.renderAt == nil {
+		return outPath, native, nil
+	}
+
+	img, err := readTrimmed(outPath, pp.atDensity(native))
+	if err != nil {
+		return "", 0, err
+	}
+	cssWidth := float64(img.Bounds().Dx()) / native
+
+	need := native
+	for _, size := range sizes {
+		density := size.Scale
+		if size.Width > 0 {
+			density = float64(size.Width) / cssWidth
+		}
+		need = math.Max(need, density)
+	}
+	if need <= native {
+		return outPath, native, nil
+	}
+	// Quarter steps keep the master stable across small layout changes.
+	need = math.Ceil(need*4) / 4
+
+	if err := ensureDir(sizesDir); err != nil {
+		return "", 0, err
+	}
+	master := filepath.Join(sizesDir, filepath.Base(outPath))
+	fmt.Printf("   ↳ rendering a %.2gx master for the sizes\n", need)
+	if err := r.renderAt(srcPath, master, t, need); err != nil {
+		return "", 0, err
+	}
+	return master, need, nil
+}
+
+// writeSizes resamples a raw render (before post-processing) into every
+// configured size next to outPath, e.g. name@2x.png and name.thumb.png. The
+// master is taken to be scale device pixels per CSS pixel; sizes asking for
+// more are capped at its resolution rather than upscaled, and capHint says why.
+func writeSizes(masterPath, outPath string, sizes []sizeConfig, pp postProcessConfig, scale float64, capHint string) ([]sizedOutput, error) {
+	img, err := readTrimmed(masterPath, pp.atDensity(scale))
+	if err != nil {
+		return nil, err
+	}
+	mw := img.Bounds().Dx()
+	cssWidth := float64(mw) / scale
+
+	base := outPath[:len(outPath)-len(filepath.Ext(outPath))]
+	var outs []sizedOutput
+	for _, size := range sizes {
+		w := size.Width
+		if size.Scale > 0 {
+			w = int(math.Round(cssWidth * size.Scale))
+		}
+		if w > mw {
+			fmt.Printf("   ⚠️  %s capped at %.2gx (%dpx): %s\n", size.Suffix, scale, mw, capHint)
+			w = mw
+		}
+
+		resized := img
+		if w < mw {
+			resized = resizeToWidth(img, w)
+		}
+		data, _, _, err := encodeSmallest(resized, pp)
+		if err != nil {
+			return nil, err
+		}
+		out := sizedOutput{
+			Size:    size,
+			Path:    base + size.Suffix + filepath.Ext(outPath),
+			Width:   resized.Bounds().Dx(),
+			Height:  resized.Bounds().Dy(),
+			Density: float64(resized.Bounds().Dx()) / cssWidth,
+		}
+		if err := os.WriteFile(out.Path, data, 0644); err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+// readTrimmed reads a PNG and trims its borders when post-processing does.
+// pp's margin must already be in the image's device pixels, see atDensity.
+func readTrimmed(path string, pp postProcessConfig) (*image.NRGBA, error) {
+	src, err := readPNG(path)
+	if err != nil {
+		return nil, err
+	}
+	img := toNRGBA(src)
+	if pp.Trim {
+		img = trimBorders(img, pp.Margin)
+	}
+	return img, nil
+}
+
+// sizeCapHint explains, per renderer, why a size can end up capped.
+func sizeCapHint(r diagramRenderer) string {
+	if r.renderAt != nil {
+		return fmt.Sprintf("the %s master came out smaller than requested", r.tool)
+	}
+	return fmt.Sprintf("%s renders at %.2gx and sizes are never upscaled", r.tool, nativeScale(r))
+}
+
+// nativeScale returns the device pixels per CSS pixel a renderer produces:
+// the puppeteer deviceScaleFactor for Mermaid, 1 for the others.
+func nativeScale(r diagramRenderer) float64 {
+	if r.fence != "mermaid" {
+		return 1
+	}
+	cfg, err := readPuppeteerConfig()
+	if err != nil {
+		return 1
+	}
+	viewport, _ := cfg["defaultViewport"].(map[string]any)
+	if scale, ok := viewport["deviceScaleFactor"].(float64); ok && scale > 0 {
+		return scale
+	}
+	return 1
+}
+
+// readPuppeteerConfig reads puppeteer-config.json as a generic JSON object.
+func readPuppeteerConfig() (map[string]any, error) {
+	data, err := os.ReadFile(puppeteerConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]any
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", puppeteerConfigPath, err)
+	}
+	return cfg, nil
+}
+
+// renderFileAt renders a .mmd file like renderFile, with puppeteer's
+// deviceScaleFactor set to scale through a derived config in sizesDir.
+func renderFileAt(input, output string, t theme, scale float64) error {
+	cfg, err := readPuppeteerConfig()
+	if err != nil {
+		return err
+	}
+	viewport, _ := cfg["defaultViewport"].(map[string]any)
+	if viewport == nil {
+		viewport = map[string]any{}
+	}
+	viewport["deviceScaleFactor"] = scale
+	cfg["defaultViewport"] = viewport
+
+	if err := ensureDir(sizesDir); err != nil {
+		return err
+	}
+	path := filepath.Join(sizesDir, "puppeteer-config@"+strconv.FormatFloat(scale, 'f', -1, 64)+"x.json")
+	if err := writeJSON(path, cfg); err != nil {
+		return err
+	}
+	return renderMermaid(mmdcCommand, path, input, output, t)
+}
@@ -0,0 +1,173 @@
+//go:build mage
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestPNG writes a solid w×h PNG.
+func writeTestPNG(t *testing.T, path string, w, h int) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	img.Set(0, 0, color.NRGBA{A: 0xFF})
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+var testSizes = []sizeConfig{{Suffix: "@1x", Scale: 1}, {Suffix: "@2x", Scale: 2}, {Suffix: ".thumb", Width: 60}}
+
+func TestSizesRenderHighDensityMaster(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(puppeteerConfigPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(puppeteerConfigPath, []byte(`{"defaultViewport": {"deviceScaleFactor": 1.5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// A 100×40 CSS-pixel diagram rendered at 1.5x.
+	outPath := filepath.Join(genPNGDir, "d.png")
+	writeTestPNG(t, outPath, 150, 60)
+	var scales []float64
+	r := diagramRenderer{fence: "mermaid", tool: "mermaid-cli", renderAt: func(input, output string, th theme, scale float64) error {
+		scales = append(scales, scale)
+		writeTestPNG(t, output, int(100*scale), int(40*scale))
+		return nil
+	}}
+
+	master, scale, err := sizeMaster(r, "d.mmd", outPath, theme{}, testSizes, postProcessConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scales) != 1 || scale != 2 || master != filepath.Join(sizesDir, "d.png") {
+		t.Fatalf("sizeMaster = %s at %gx (renders %v), want a 2x master in %s", master, scale, scales, sizesDir)
+	}
+	outs, err := writeSizes(master, outPath, testSizes, postProcessConfig{}, scale, sizeCapHint(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []struct {
+		path    string
+		width   int
+		density float64
+	}{
+		{"d@1x.png", 100, 1},
+		{"d@2x.png", 200, 2},
+		{"d.thumb.png", 60, 0.6},
+	} {
+		o := outs[i]
+		if o.Path != filepath.Join(genPNGDir, want.path) || o.Width != want.width || o.Density != want.density {
+			t.Errorf("size %d = %s %dpx at %gx, want %s %dpx at %gx", i, o.Path, o.Width, o.Density, want.path, want.width, want.density)
+		}
+	}
+
+	// Sizes the regular render already covers reuse it.
+	scales = nil
+	master, scale, err = sizeMaster(r, "d.mmd", outPath, theme{}, testSizes[:1], postProcessConfig{})
+	if err != nil || master != outPath || scale != 1.5 || len(scales) != 0 {
+		t.Errorf("1x only: sizeMaster = %s at %gx, %v (renders %v); want the regular render", master, scale, err, scales)
+	}
+}
+
+func TestSizesCapWithoutRenderAt(t *testing.T) {
+	t.Chdir(t.TempDir())
+	outPath := filepath.Join(genPNGDir, "d.png")
+	writeTestPNG(t, outPath, 100, 40)
+	r := diagramRenderer{fence: "d2", tool: "d2"}
+
+	master, scale, err := sizeMaster(r, "d.d2", outPath, theme{}, testSizes, postProcessConfig{})
+	if err != nil || master != outPath || scale != 1 {
+		t.Fatalf("sizeMaster = %s at %gx, %v; want the regular render at 1x", master, scale, err)
+	}
+	if hint := sizeCapHint(r); hint != "d2 renders at 1x and sizes are never upscaled" {
+		t.Errorf("cap hint = %q", hint)
+	}
+	outs, err := writeSizes(master, outPath, testSizes, postProcessConfig{}, scale, sizeCapHint(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o := outs[1]; o.Width != 100 || o.Density != 1 {
+		t.Errorf("@2x = %dpx at %gx, want capped at 100px and 1x", o.Width, o.Density)
+	}
+}
+
+// writeBlockPNG renders a 120×60 CSS-pixel white canvas with an 80×20 black
+// block at (20, 20), at scale device pixels per CSS pixel.
+func writeBlockPNG(t *testing.T, path string, scale float64) {
+	t.Helper()
+	px := func(v int) int { return int(float64(v) * scale) }
+	img := solidImage(px(120), px(60), color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}, nil)
+	for y := px(20); y < px(40); y++ {
+		for x := px(20); x < px(100); x++ {
+			img.SetNRGBA(x, y, color.NRGBA{A: 0xFF})
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	mustWritePNG(t, path, img)
+}
+
+func TestSizesKeepCSSMargin(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.MkdirAll(filepath.Dir(puppeteerConfigPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(puppeteerConfigPath, []byte(`{"defaultViewport": {"deviceScaleFactor": 1.5}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	outPath := filepath.Join(genPNGDir, "d.png")
+	writeBlockPNG(t, outPath, 1.5)
+	r := diagramRenderer{fence: "mermaid", tool: "mermaid-cli", renderAt: func(input, output string, th theme, scale float64) error {
+		writeBlockPNG(t, output, scale)
+		return nil
+	}}
+	pp := postProcessConfig{Trim: true, Margin: 10}
+
+	master, scale, err := sizeMaster(r, "d.mmd", outPath, theme{}, testSizes[:2], pp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := writeSizes(master, outPath, testSizes[:2], pp, scale, sizeCapHint(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := postProcessPNG(outPath, pp.atDensity(nativeScale(r))); err != nil {
+		t.Fatal(err)
+	}
+
+	// The 80×20 block plus a 10 CSS-pixel margin is 100×40 CSS pixels at every density.
+	for _, o := range []struct {
+		path    string
+		density float64
+	}{{outPath, 1.5}, {outs[0].Path, 1}, {outs[1].Path, 2}} {
+		img := toNRGBA(mustReadPNG(t, o.path))
+		b := img.Bounds()
+		margin := int(10 * o.density)
+		if b.Dx() != int(100*o.density) || b.Dy() != int(40*o.density) {
+			t.Errorf("%s is %dx%d, want %gx of 100x40", o.path, b.Dx(), b.Dy(), o.density)
+			continue
+		}
+		if img.NRGBAAt(margin-1, margin-1).R != 0xFF || img.NRGBAAt(margin, margin).R != 0 {
+			t.Errorf("%s: content does not start after a %dpx margin", o.path, margin)
+		}
+	}
+}
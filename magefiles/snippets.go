@@ -0,0 +1,79 @@
+//go:build mage
+
+package main
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// writePictureSnippet writes a ready-to-paste <picture> element that picks the
+// dark or light variant of a diagram through prefers-color-scheme.
+func writePictureSnippet(base string, cfg projectConfig) (string, error) {
+	url := func(name string) string {
+		return html.EscapeString(path.Join(cfg.PublicPath, name))
+	}
+
+	var b strings.Builder
+	b.WriteString("<picture>\n")
+	for _, v := range cfg.variants() {
+		fmt.Fprintf(&b, "  <source srcset=\"%s\" media=\"(prefers-color-scheme: %s)\">\n",
+			url(base+"."+v[0]+"."+outputExt), v[0])
+	}
+	fmt.Fprintf(&b, "  <img src=\"%s\" alt=\"%s\">\n", url(base+"."+outputExt), html.EscapeString(diagramTitle(base)))
+	b.WriteString("</picture>\n")
+
+	snippetPath := filepath.Join(genHTMLDir, base+".picture.html")
+	if err := ensureDir(genHTMLDir); err != nil {
+		return "", err
+	}
+	return snippetPath, os.WriteFile(snippetPath, []byte(b.String()), 0644)
+}
+
+// writeSrcsetSnippet writes a ready-to-paste <img> whose srcset lists the
+// scale-based sizes of a diagram, with the CSS size set to avoid layout shift.
+// It returns "" when no scale-based sizes are configured.
+func writeSrcsetSnippet(base string, cfg projectConfig, outs []sizedOutput) (string, error) {
+	var scaled []sizedOutput
+	for _, o := range outs {
+		if o.Size.Scale > 0 {
+			scaled = append(scaled, o)
+		}
+	}
+	if len(scaled) == 0 {
+		return "", nil
+	}
+	sort.SliceStable(scaled, func(i, j int) bool { return scaled[i].Density < scaled[j].Density })
+
+	url := func(o sizedOutput) string {
+		return html.EscapeString(path.Join(cfg.PublicPath, filepath.Base(o.Path)))
+	}
+	var srcset []string
+	for _, o := range scaled {
+		srcset = append(srcset, fmt.Sprintf("%s %sx", url(o), strconv.FormatFloat(math.Round(o.Density*100)/100, 'f', -1, 64)))
+	}
+	first := scaled[0]
+	cssWidth := int(math.Round(float64(first.Width) / first.Density))
+	cssHeight := int(math.Round(float64(first.Height) / first.Density))
+
+	snippet := fmt.Sprintf("<img src=\"%s\"\n     srcset=\"%s\"\n     width=\"%d\" height=\"%d\" alt=\"%s\">\n",
+		url(first), strings.Join(srcset, ", "), cssWidth, cssHeight, html.EscapeString(diagramTitle(base)))
+
+	snippetPath := filepath.Join(genHTMLDir, base+".srcset.html")
+	if err := ensureDir(genHTMLDir); err != nil {
+		return "", err
+	}
+	return snippetPath, os.WriteFile(snippetPath, []byte(snippet), 0644)
+}
+
+// diagramTitle turns a source name like "wireguard-topology" into alt text.
+func diagramTitle(base string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(base, "-", " "), "_", " ")
+}
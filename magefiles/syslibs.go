@@ -0,0 +1,317 @@
+//go:build mage
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/magefile/mage/sh"
+)
+
+// Package families that VerifySystemLibs knows how to install into.
+const (
+	distroDebian = "debian"
+	distroFedora = "fedora"
+	distroArch   = "arch"
+)
+
+// libPackages names the package providing a shared object on each family.
+// t64 is the Debian/Ubuntu name after the 64-bit time_t transition (Ubuntu
+// 24.04, Debian 13); empty means it kept the classic name.
+type libPackages struct {
+	debian, t64, fedora, arch string
+}
+
+// chromiumLibs maps the shared objects headless Chromium loads to packages.
+var chromiumLibs = map[string]libPackages{
+	"libnss3.so":             {debian: "libnss3", fedora: "nss", arch: "nss"},
+	"libnspr4.so":            {debian: "libnspr4", fedora: "nspr", arch: "nspr"},
+	"libatk-1.0.so.0":        {debian: "libatk1.0-0", t64: "libatk1.0-0t64", fedora: "atk", arch: "at-spi2-core"},
+	"libatk-bridge-2.0.so.0": {debian: "libatk-bridge2.0-0", t64: "libatk-bridge2.0-0t64", fedora: "at-spi2-atk", arch: "at-spi2-core"},
+	"libatspi.so.0":          {debian: "libatspi2.0-0", t64: "libatspi2.0-0t64", fedora: "at-spi2-core", arch: "at-spi2-core"},
+	"libcups.so.2":           {debian: "libcups2", t64: "libcups2t64", fedora: "cups-libs", arch: "libcups"},
+	"libdrm.so.2":            {debian: "libdrm2", fedora: "libdrm", arch: "libdrm"},
+	"libxkbcommon.so.0":      {debian: "libxkbcommon0", fedora: "libxkbcommon", arch: "libxkbcommon"},
+	"libXdamage.so.1":        {debian: "libxdamage1", fedora: "libXdamage", arch: "libxdamage"},
+	"libXfixes.so.3":         {debian: "libxfixes3", fedora: "libXfixes", arch: "libxfixes"},
+	"libXrandr.so.2":         {debian: "libxrandr2", fedora: "libXrandr", arch: "libxrandr"},
+	"libasound.so.2":         {debian: "libasound2", t64: "libasound2t64", fedora: "alsa-lib", arch: "alsa-lib"},
+	"libpangocairo-1.0.so.0": {debian: "libpangocairo-1.0-0", fedora: "pango", arch: "pango"},
+	"libpango-1.0.so.0":      {debian: "libpango-1.0-0", fedora: "pango", arch: "pango"},
+	"libcairo.so.2":          {debian: "libcairo2", fedora: "cairo", arch: "cairo"},
+	"libgbm.so.1":            {debian: "libgbm1", fedora: "mesa-libgbm", arch: "mesa"},
+	"libxshmfence.so.1":      {debian: "libxshmfence1", fedora: "libxshmfence", arch: "libxshmfence"},
+	"libXcomposite.so.1":     {debian: "libxcomposite1", fedora: "libXcomposite", arch: "libxcomposite"},
+	"libXext.so.6":           {debian: "libxext6", fedora: "libXext", arch: "libxext"},
+	"libX11.so.6":            {debian: "libx11-6", fedora: "libX11", arch: "libx11"},
+	"libX11-xcb.so.1":        {debian: "libx11-xcb1", fedora: "libX11-xcb", arch: "libx11"},
+	"libxcb.so.1":            {debian: "libxcb1", fedora: "libxcb", arch: "libxcb"},
+	"libXrender.so.1":        {debian: "libxrender1", fedora: "libXrender", arch: "libxrender"},
+	"libgtk-3.so.0":          {debian: "libgtk-3-0", t64: "libgtk-3-0t64", fedora: "gtk3", arch: "gtk3"},
+}
+
+// defaultLibDirs are searched when ldconfig is unavailable, in addition to
+// the directories listed in /etc/ld.so.conf.
+var defaultLibDirs = []string{
+	"/lib", "/usr/lib", "/lib64", "/usr/lib64", "/usr/local/lib",
+	"/lib/x86_64-linux-gnu", "/usr/lib/x86_64-linux-gnu",
+	"/lib/aarch64-linux-gnu", "/usr/lib/aarch64-linux-gnu",
+}
+
+// missingSystemLibs returns the Chromium shared objects the dynamic linker
+// cannot find, sorted by name.
+func missingSystemLibs() []string {
+	available := sharedLibraries()
+
+	missing := []string{}
+	for soname := range chromiumLibs {
+		if !available[soname] {
+			missing = append(missing, soname)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// sharedLibraries returns the shared object names the dynamic linker can
+// resolve. SYSTEM_LIB_PATH (colon-separated directories) replaces the lookup
+// entirely, which makes the check testable against a fake library tree.
+// Otherwise it uses the ldconfig cache, falling back to scanning the
+// ld.so.conf directories; LD_LIBRARY_PATH is honoured in both cases.
+func sharedLibraries() map[string]bool {
+	if env := os.Getenv("SYSTEM_LIB_PATH"); env != "" {
+		return scanLibDirs(filepath.SplitList(env))
+	}
+
+	libs := ldconfigCache()
+	if libs == nil {
+		dirs := append(ldSoConfDirs("/etc/ld.so.conf"), defaultLibDirs...)
+		libs = scanLibDirs(dirs)
+	}
+	for name := range scanLibDirs(filepath.SplitList(os.Getenv("LD_LIBRARY_PATH"))) {
+		libs[name] = true
+	}
+	return libs
+}
+
+// ldconfigCache parses `ldconfig -p`, or returns nil if it cannot run.
+func ldconfigCache() map[string]bool {
+	bin, err := exec.LookPath("ldconfig")
+	if err != nil {
+		bin = "/sbin/ldconfig"
+	}
+	out, err := exec.Command(bin, "-p").Output()
+	if err != nil {
+		return nil
+	}
+
+	libs := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		// "\tlibnss3.so (libc6,x86-64) => /lib/x86_64-linux-gnu/libnss3.so"
+		name, _, ok := strings.Cut(strings.TrimSpace(line), " (")
+		if ok {
+			libs[name] = true
+		}
+	}
+	return libs
+}
+
+// ldSoConfDirs returns the directories listed in an ld.so.conf file,
+// following its include directives.
+func ldSoConfDirs(path string) []string {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "include "):
+			pattern := strings.TrimSpace(strings.TrimPrefix(line, "include "))
+			if !filepath.IsAbs(pattern) {
+				pattern = filepath.Join(filepath.Dir(path), pattern)
+			}
+			matches, _ := filepath.Glob(pattern)
+			for _, m := range matches {
+				dirs = append(dirs, ldSoConfDirs(m)...)
+			}
+		default:
+			dirs = append(dirs, line)
+		}
+	}
+	return dirs
+}
+
+// scanLibDirs returns the file names found in dirs.
+func scanLibDirs(dirs []string) map[string]bool {
+	libs := map[string]bool{}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			libs[e.Name()] = true
+		}
+	}
+	return libs
+}
+
+// distro describes the host OS as read from os-release.
+type distro struct {
+	ID        string
+	Like      []string
+	VersionID string
+	Codename  string
+	Name      string
+}
+
+// preT64DebianCodenames are the Debian releases before the time_t transition.
+// Debian testing and sid set only VERSION_CODENAME, so any other codename
+// without a VERSION_ID is taken to be trixie or later.
+var preT64DebianCodenames = []string{"buster", "bullseye", "bookworm"}
+
+// detectDistro parses OS_RELEASE_FILE (default /etc/os-release).
+func detectDistro() (distro, error) {
+	path := os.Getenv("OS_RELEASE_FILE")
+	if path == "" {
+		path = "/etc/os-release"
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return distro{}, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var d distro
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		switch key {
+		case "ID":
+			d.ID = value
+		case "ID_LIKE":
+			d.Like = strings.Fields(value)
+		case "VERSION_ID":
+			d.VersionID = value
+		case "VERSION_CODENAME":
+			d.Codename = value
+		case "PRETTY_NAME":
+			d.Name = value
+		}
+	}
+	if d.Name == "" {
+		version := d.VersionID
+		if version == "" {
+			version = d.Codename
+		}
+		d.Name = strings.TrimSpace(d.ID + " " + version)
+	}
+	return d, nil
+}
+
+// family returns the package family the distro installs from, or "".
+func (d distro) family() string {
+	for _, id := range append([]string{d.ID}, d.Like...) {
+		switch id {
+		case "debian", "ubuntu":
+			return distroDebian
+		case "fedora", "rhel", "centos":
+			return distroFedora
+		case "arch":
+			return distroArch
+		}
+	}
+	return ""
+}
+
+// t64 reports whether the distro uses the post-time_t-transition package
+// names: Ubuntu 24.04 and Debian 13 onwards (including testing and sid), and
+// their derivatives.
+func (d distro) t64() bool {
+	major, _ := strconv.Atoi(strings.SplitN(d.VersionID, ".", 2)[0])
+	switch {
+	case d.ID == "ubuntu":
+		return major >= 24
+	case d.ID == "debian" && d.VersionID == "" && d.Codename != "":
+		return !slices.Contains(preT64DebianCodenames, d.Codename)
+	case d.ID == "debian":
+		return major >= 13
+	}
+	// Derivatives number their releases differently; ask apt instead.
+	if d.family() == distroDebian {
+		return exec.Command("apt-cache", "show", "libasound2t64").Run() == nil
+	}
+	return false
+}
+
+// packagesFor maps missing shared objects to this distro's package names,
+// deduplicated. Libraries without a known package are returned in unknown.
+func (d distro) packagesFor(sonames []string) (pkgs, unknown []string) {
+	family, t64 := d.family(), false
+	if family == distroDebian {
+		t64 = d.t64()
+	}
+
+	seen := map[string]bool{}
+	for _, soname := range sonames {
+		p, ok := chromiumLibs[soname]
+		var pkg string
+		switch {
+		case !ok:
+		case family == distroDebian && t64 && p.t64 != "":
+			pkg = p.t64
+		case family == distroDebian:
+			pkg = p.debian
+		case family == distroFedora:
+			pkg = p.fedora
+		case family == distroArch:
+			pkg = p.arch
+		}
+		if pkg == "" {
+			unknown = append(unknown, soname)
+			continue
+		}
+		if !seen[pkg] {
+			seen[pkg] = true
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	return pkgs, unknown
+}
+
+// install installs packages with the distro's package manager via sudo.
+func (d distro) install(pkgs []string) error {
+	switch d.family() {
+	case distroDebian:
+		return aptInstall(pkgs...)
+	case distroFedora:
+		fmt.Printf("Installing %s (requires sudo)...\n", strings.Join(pkgs, ", "))
+		return sh.RunV("sudo", append([]string{"dnf", "install", "-y"}, pkgs...)...)
+	case distroArch:
+		fmt.Printf("Installing %s (requires sudo)...\n", strings.Join(pkgs, ", "))
+		return sh.RunV("sudo", append([]string{"pacman", "-S", "--needed", "--noconfirm"}, pkgs...)...)
+	default:
+		return fmt.Errorf("no package manager known for %s", d.Name)
+	}
+}
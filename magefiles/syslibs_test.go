@@ -0,0 +1,111 @@
+//go:build mage
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDetectDistroPackages(t *testing.T) {
+	sonames := []string{"libasound.so.2", "libgtk-3.so.0", "libnss3.so", "libpango-1.0.so.0", "libpangocairo-1.0.so.0", "libfoo.so.1"}
+	for _, tc := range []struct {
+		name      string
+		osRelease string
+		family    string
+		pretty    string
+		pkgs      []string
+	}{
+		{
+			name:      "debian 12",
+			osRelease: "PRETTY_NAME=\"Debian GNU/Linux 12 (bookworm)\"\nID=debian\nVERSION_ID=\"12\"\nVERSION_CODENAME=bookworm\n",
+			family:    distroDebian,
+			pretty:    "Debian GNU/Linux 12 (bookworm)",
+			pkgs:      []string{"libasound2", "libgtk-3-0", "libnss3", "libpango-1.0-0", "libpangocairo-1.0-0"},
+		},
+		{
+			name:      "ubuntu 24.04",
+			osRelease: "PRETTY_NAME=\"Ubuntu 24.04.1 LTS\"\nID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"24.04\"\nVERSION_CODENAME=noble\n",
+			family:    distroDebian,
+			pretty:    "Ubuntu 24.04.1 LTS",
+			pkgs:      []string{"libasound2t64", "libgtk-3-0t64", "libnss3", "libpango-1.0-0", "libpangocairo-1.0-0"},
+		},
+		{
+			name:      "debian sid",
+			osRelease: "PRETTY_NAME=\"Debian GNU/Linux trixie/sid\"\nID=debian\nVERSION_CODENAME=trixie\n",
+			family:    distroDebian,
+			pretty:    "Debian GNU/Linux trixie/sid",
+			pkgs:      []string{"libasound2t64", "libgtk-3-0t64", "libnss3", "libpango-1.0-0", "libpangocairo-1.0-0"},
+		},
+		{
+			name:      "fedora",
+			osRelease: "NAME=\"Fedora Linux\"\nID=fedora\nVERSION_ID=40\n",
+			family:    distroFedora,
+			pretty:    "fedora 40",
+			pkgs:      []string{"alsa-lib", "gtk3", "nss", "pango"},
+		},
+		{
+			name:      "arch",
+			osRelease: "NAME=\"Arch Linux\"\nPRETTY_NAME=\"Arch Linux\"\nID=arch\nBUILD_ID=rolling\n",
+			family:    distroArch,
+			pretty:    "Arch Linux",
+			pkgs:      []string{"alsa-lib", "gtk3", "nss", "pango"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "os-release")
+			if err := os.WriteFile(path, []byte(tc.osRelease), 0644); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("OS_RELEASE_FILE", path)
+
+			d, err := detectDistro()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.family() != tc.family || d.Name != tc.pretty {
+				t.Errorf("detectDistro = %+v (family %q), want family %q named %q", d, d.family(), tc.family, tc.pretty)
+			}
+			pkgs, unknown := d.packagesFor(sonames)
+			if !reflect.DeepEqual(pkgs, tc.pkgs) {
+				t.Errorf("packages = %v, want %v", pkgs, tc.pkgs)
+			}
+			if !reflect.DeepEqual(unknown, []string{"libfoo.so.1"}) {
+				t.Errorf("unknown = %v, want [libfoo.so.1]", unknown)
+			}
+		})
+	}
+}
+
+func TestMissingSystemLibs(t *testing.T) {
+	dirs := []string{t.TempDir(), t.TempDir()}
+	i := 0
+	for soname := range chromiumLibs {
+		if soname == "libgbm.so.1" || soname == "libnss3.so" {
+			continue
+		}
+		// Spread the libraries over both directories of the search path.
+		if err := os.WriteFile(filepath.Join(dirs[i%2], soname), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		i++
+	}
+	t.Setenv("SYSTEM_LIB_PATH", strings.Join(dirs, string(os.PathListSeparator)))
+
+	if got := missingSystemLibs(); !reflect.DeepEqual(got, []string{"libgbm.so.1", "libnss3.so"}) {
+		t.Errorf("missing = %v, want [libgbm.so.1 libnss3.so]", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(dirs[0], "libgbm.so.1"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dirs[1], "libnss3.so"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := missingSystemLibs(); len(got) != 0 {
+		t.Errorf("missing = %v with every library present", got)
+	}
+}
@@ -0,0 +1,177 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// themesDir holds one sub-directory per named theme.
+var themesDir = "assets/diagrams/themes"
+
+// themeSamplePath is the diagram rendered by Diagrams.Themes for comparison.
+var themeSamplePath = "assets/diagrams/themes/sample.mmd"
+
+// theme is a named style: a Mermaid config, a page background and extra CSS.
+type theme struct {
+	Name        string `json:"-"`
+	Dir         string `json:"-"`
+	Description string `json:"description"`
+	Background  string `json:"background"`
+}
+
+// mermaidConfig returns the path of the theme's Mermaid config.
+func (t theme) mermaidConfig() string {
+	return filepath.Join(t.Dir, "mermaid-config.json")
+}
+
+// cssFile returns the path of the theme's CSS, or "" when it has none.
+func (t theme) cssFile() string {
+	path := filepath.Join(t.Dir, "theme.css")
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// colors returns the theme's shared palette, using the theme background.
+func (t theme) colors() (themeColors, error) {
+	c, err := loadThemeColors(t.mermaidConfig())
+	if err != nil {
+		return c, err
+	}
+	if t.Background != "" {
+		c.Background = t.Background
+	}
+	return c, nil
+}
+
+// loadTheme reads a theme by name from themesDir.
+func loadTheme(name string) (theme, error) {
+	t := theme{Name: name, Dir: filepath.Join(themesDir, name)}
+
+	data, err := os.ReadFile(filepath.Join(t.Dir, "theme.json"))
+	if err != nil {
+		return t, fmt.Errorf("theme %q not found in %s: %w", name, themesDir, err)
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return t, fmt.Errorf("failed to parse theme %q: %w", name, err)
+	}
+	if _, err := os.Stat(t.mermaidConfig()); err != nil {
+		return t, fmt.Errorf("theme %q has no mermaid-config.json: %w", name, err)
+	}
+	if t.Background == "" {
+		c, err := loadThemeColors(t.mermaidConfig())
+		if err != nil {
+			return t, err
+		}
+		t.Background = c.Background
+	}
+	return t, nil
+}
+
+// listThemes returns every theme in themesDir, sorted by name.
+func listThemes() ([]theme, error) {
+	entries, err := os.ReadDir(themesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+
+	themes := make([]theme, 0, len(names))
+	for _, name := range names {
+		t, err := loadTheme(name)
+		if err != nil {
+			return nil, err
+		}
+		themes = append(themes, t)
+	}
+	return themes, nil
+}
+
+// themeColors holds the shared palette every diagram renderer is styled from.
+// It is read from the themeVariables block of a Mermaid config so that
+// non-Mermaid renderers stay visually in step with Mermaid output.
+type themeColors struct {
+	Background string
+	Primary    string
+	Secondary  string
+	Tertiary   string
+	Border     string
+	Text       string
+	Line       string
+	Note       string
+	NoteText   string
+	Cluster    string
+	Title      string
+	FontFamily string
+	FontSize   string
+}
+
+// loadThemeColors reads the themeVariables from a Mermaid config file.
+func loadThemeColors(configPath string) (themeColors, error) {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return themeColors{}, err
+	}
+
+	var cfg struct {
+		ThemeVariables map[string]any `json:"themeVariables"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return themeColors{}, fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+
+	str := func(key, fallback string) string {
+		if s, ok := cfg.ThemeVariables[key].(string); ok && s != "" {
+			return s
+		}
+		return fallback
+	}
+
+	c := themeColors{
+		Background: str("background", ""),
+		Primary:    str("primaryColor", ""),
+		Border:     str("primaryBorderColor", ""),
+		Text:       str("primaryTextColor", ""),
+		FontFamily: str("fontFamily", "sans-serif"),
+		FontSize:   str("fontSize", "12px"),
+	}
+	if c.Background == "" || c.Primary == "" || c.Text == "" {
+		return themeColors{}, fmt.Errorf("%s must define background, primaryColor and primaryTextColor", configPath)
+	}
+	if c.Border == "" {
+		c.Border = c.Text
+	}
+	c.Secondary = str("secondaryColor", c.Primary)
+	c.Tertiary = str("tertiaryColor", c.Secondary)
+	c.Line = str("lineColor", c.Border)
+	c.Note = str("noteBkgColor", c.Secondary)
+	c.NoteText = str("noteTextColor", c.Text)
+	c.Cluster = str("clusterBkg", c.Tertiary)
+	c.Title = str("titleColor", c.Text)
+	return c, nil
+}
+
+// primaryFont returns the first family from the CSS font-family list.
+func (c themeColors) primaryFont() string {
+	first := strings.Split(c.FontFamily, ",")[0]
+	return strings.Trim(strings.TrimSpace(first), `"'`)
+}
+
+// fontSizePx returns the font size without its CSS unit.
+func (c themeColors) fontSizePx() string {
+	return strings.TrimSuffix(strings.TrimSpace(c.FontSize), "px")
+}
@@ -0,0 +1,282 @@
+//go:build mage
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// semver is a parsed MAJOR.MINOR.PATCH[-PRERELEASE] version.
+type semver struct {
+	Major, Minor, Patch int
+	Pre                 string
+}
+
+func (v semver) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// compare returns -1, 0 or 1. A pre-release sorts before its release.
+func (v semver) compare(o semver) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d < 0 {
+			return -1
+		}
+		if d > 0 {
+			return 1
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+// preChunk matches the letter and digit runs of a pre-release tag.
+var preChunk = regexp.MustCompile(`[0-9]+|[^0-9]+`)
+
+// comparePre orders pre-release tags with digit runs compared numerically,
+// so rc2 < rc10 and beta1 < rc1.
+func comparePre(a, b string) int {
+	ca, cb := preChunk.FindAllString(a, -1), preChunk.FindAllString(b, -1)
+	for i := 0; i < len(ca) && i < len(cb); i++ {
+		na, errA := strconv.Atoi(ca[i])
+		nb, errB := strconv.Atoi(cb[i])
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA == nil) != (errB == nil):
+			// Numeric identifiers sort before alphanumeric ones.
+			if errA == nil {
+				return -1
+			}
+			return 1
+		case ca[i] != cb[i]:
+			if ca[i] < cb[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(ca) < len(cb):
+		return -1
+	case len(ca) > len(cb):
+		return 1
+	}
+	return 0
+}
+
+// versionPattern finds a version number inside tool output such as
+// "go version go1.25.3 linux/amd64", "go version go1.26rc1 linux/amd64" or
+// "PlantUML version 1.2024.7 (...)".
+var versionPattern = regexp.MustCompile(`\d+(\.\d+){0,2}(-[0-9A-Za-z.-]+|(alpha|beta|rc)\d+)?`)
+
+// extractVersion returns the first version-looking token in tool output.
+func extractVersion(output string) (string, error) {
+	v := versionPattern.FindString(output)
+	if v == "" {
+		return "", fmt.Errorf("no version number found in %q", strings.TrimSpace(output))
+	}
+	return v, nil
+}
+
+// parseSemver parses a version, accepting a leading "v" or "go" and missing
+// minor/patch parts ("1.25" is 1.25.0). Go's unhyphenated pre-releases are
+// accepted too: "go1.26rc1" is 1.26.0-rc1. Leading zeros are rejected, so
+// "10.9.01" is an error rather than a near match of 10.9.0.
+func parseSemver(s string) (semver, int, error) {
+	raw := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "v"), "go")
+	core, pre, _ := strings.Cut(raw, "-")
+	if pre == "" {
+		if i := strings.IndexAny(core, "abcdefghijklmnopqrstuvwxyz"); i > 0 {
+			core, pre = core[:i], core[i:]
+		}
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return semver{}, 0, fmt.Errorf("invalid version %q", s)
+	}
+	nums := make([]int, 3)
+	for i, p := range parts {
+		if p == "" || (len(p) > 1 && p[0] == '0') {
+			return semver{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return semver{}, 0, fmt.Errorf("invalid version %q", s)
+		}
+		nums[i] = n
+	}
+	return semver{nums[0], nums[1], nums[2], pre}, len(parts), nil
+}
+
+// versionTerm is a single comparison such as ">=1.25.0".
+type versionTerm struct {
+	op string
+	v  semver
+}
+
+func (t versionTerm) String() string { return t.op + t.v.String() }
+
+func (t versionTerm) matches(v semver) bool {
+	c := v.compare(t.v)
+	switch t.op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	case "<":
+		// As in npm, an upper bound excludes pre-releases of its own version
+		// unless the bound is itself a pre-release: <1.26 rejects 1.26.0-rc1.
+		if v.Pre != "" && t.v.Pre == "" && v.Major == t.v.Major && v.Minor == t.v.Minor && v.Patch == t.v.Patch {
+			return false
+		}
+		return c < 0
+	default: // "<="
+		return c <= 0
+	}
+}
+
+// versionConstraint is a set of alternatives ("||"), each a list of terms
+// that must all hold.
+type versionConstraint struct {
+	expr string
+	alts [][]versionTerm
+}
+
+// parseConstraint parses expressions like ">=1.25.0 <1.26", "~10.9",
+// "^1.2.3" or "=10.9.0 || >=11.0.0". A bare version means "=".
+func parseConstraint(expr string) (versionConstraint, error) {
+	c := versionConstraint{expr: strings.TrimSpace(expr)}
+	for _, alt := range strings.Split(expr, "||") {
+		var terms []versionTerm
+		for _, field := range strings.Fields(alt) {
+			expanded, err := parseTerm(field)
+			if err != nil {
+				return c, fmt.Errorf("invalid constraint %q: %w", expr, err)
+			}
+			terms = append(terms, expanded...)
+		}
+		if len(terms) == 0 {
+			return c, fmt.Errorf("invalid constraint %q: empty range", expr)
+		}
+		c.alts = append(c.alts, terms)
+	}
+	return c, nil
+}
+
+// parseTerm expands one operator+version token into plain comparisons.
+func parseTerm(field string) ([]versionTerm, error) {
+	op := ""
+	for _, candidate := range []string{">=", "<=", "!=", "==", ">", "<", "=", "~", "^"} {
+		if strings.HasPrefix(field, candidate) {
+			op = candidate
+			break
+		}
+	}
+	v, parts, err := parseSemver(strings.TrimPrefix(field, op))
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case "~":
+		// ~1.2.3 and ~1.2 allow patch updates; ~1 allows minor updates.
+		upper := semver{Major: v.Major, Minor: v.Minor + 1}
+		if parts == 1 {
+			upper = semver{Major: v.Major + 1}
+		}
+		return []versionTerm{{">=", v}, {"<", upper}}, nil
+	case "^":
+		// ^ allows changes that do not modify the left-most non-zero part:
+		// ^1.2.3 <2.0.0, ^0.2.3 <0.3.0, ^0.0.3 <0.0.4. Omitted parts widen
+		// the range (^0.0 <0.1.0, ^0 <1.0.0).
+		var upper semver
+		switch {
+		case v.Major > 0 || parts == 1:
+			upper = semver{Major: v.Major + 1}
+		case v.Minor > 0 || parts == 2:
+			upper = semver{Minor: v.Minor + 1}
+		default:
+			upper = semver{Patch: v.Patch + 1}
+		}
+		return []versionTerm{{">=", v}, {"<", upper}}, nil
+	case "", "==":
+		op = "="
+	}
+	return []versionTerm{{op, v}}, nil
+}
+
+// check returns nil when v satisfies the constraint, or an error naming the
+// constraint kind ("required", "recommended") and the term that failed.
+func (c versionConstraint) check(v semver, kind string) error {
+	var failures []string
+	for _, terms := range c.alts {
+		failed := ""
+		for _, t := range terms {
+			if !t.matches(v) {
+				failed = t.String()
+				break
+			}
+		}
+		if failed == "" {
+			return nil
+		}
+		failures = append(failures, failed)
+	}
+	return fmt.Errorf("%s does not satisfy %s range %q (failed %s)", v, kind, c.expr, strings.Join(failures, ", "))
+}
+
+// checkToolVersion validates a tool's reported version against a required and
+// a recommended constraint. Missing the required range is an error; missing
+// only the recommended range prints a warning and succeeds.
+func checkToolVersion(tool, output, required, recommended string) (semver, error) {
+	raw, err := extractVersion(output)
+	if err != nil {
+		return semver{}, fmt.Errorf("%s: %w", tool, err)
+	}
+	v, _, err := parseSemver(raw)
+	if err != nil {
+		return semver{}, fmt.Errorf("%s: %w", tool, err)
+	}
+
+	req, err := parseConstraint(required)
+	if err != nil {
+		return v, err
+	}
+	if err := req.check(v, "required"); err != nil {
+		return v, fmt.Errorf("%s %w", tool, err)
+	}
+
+	if recommended != "" {
+		rec, err := parseConstraint(recommended)
+		if err != nil {
+			return v, err
+		}
+		if err := rec.check(v, "recommended"); err != nil {
+			warnf("%s %v", tool, err)
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,91 @@
+//go:build mage
+
+package main
+
+import "testing"
+
+func TestExtractAndParseVersion(t *testing.T) {
+	for _, tc := range []struct {
+		output string
+		want   string
+	}{
+		{"go version go1.25.3 linux/amd64", "1.25.3"},
+		{"go version go1.26rc1 linux/amd64", "1.26.0-rc1"},
+		{"go version go1.25beta2 darwin/arm64", "1.25.0-beta2"},
+		{"10.9.0", "10.9.0"},
+		{"v0.6.5-rc.1", "0.6.5-rc.1"},
+		{"PlantUML version 1.2024.7 (Sun Sep 22 2024)", "1.2024.7"},
+	} {
+		raw, err := extractVersion(tc.output)
+		if err != nil {
+			t.Errorf("extractVersion(%q): %v", tc.output, err)
+			continue
+		}
+		v, _, err := parseSemver(raw)
+		if err != nil || v.String() != tc.want {
+			t.Errorf("%q parsed as %v (%v), want %s", tc.output, v, err, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"10.9.01", "1.2.3.4", "latest", ""} {
+		if v, _, err := parseSemver(bad); err == nil {
+			t.Errorf("parseSemver(%q) = %v, want an error", bad, v)
+		}
+	}
+}
+
+func TestSemverCompare(t *testing.T) {
+	ordered := []string{"1.25.0", "1.26beta1", "1.26rc1", "1.26rc2", "1.26rc10", "1.26.0", "1.26.1"}
+	for i := range ordered {
+		for j := range ordered {
+			a, _, _ := parseSemver(ordered[i])
+			b, _, _ := parseSemver(ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.compare(b); got != want {
+				t.Errorf("compare(%s, %s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	for _, tc := range []struct {
+		constraint string
+		in, out    []string
+	}{
+		{">=1.25.0 <1.26", []string{"1.25.0", "1.25.9"}, []string{"1.24.9", "1.26rc1", "1.26beta1", "1.26.0"}},
+		{"<1.26.0-rc2", []string{"1.26rc1", "1.25.9"}, []string{"1.26rc2", "1.26.0"}},
+		{">=1.26.0", []string{"1.26.0", "1.27.0"}, []string{"1.26rc1", "1.26beta1"}},
+		{"~10.9", []string{"10.9.0", "10.9.5"}, []string{"10.10.0", "10.10.0-rc.1", "10.8.9"}},
+		{"~1", []string{"1.0.0", "1.9.9"}, []string{"2.0.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"1.2.2", "2.0.0"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4", "0.1.0", "0.0.2"}},
+		{"^0.0", []string{"0.0.0", "0.0.9"}, []string{"0.1.0"}},
+		{"^0", []string{"0.0.1", "0.9.0"}, []string{"1.0.0"}},
+		{"=10.9.0 || >=11.0.0", []string{"10.9.0", "11.2.0"}, []string{"10.9.1", "10.10.0"}},
+	} {
+		c, err := parseConstraint(tc.constraint)
+		if err != nil {
+			t.Errorf("parseConstraint(%q): %v", tc.constraint, err)
+			continue
+		}
+		for _, s := range tc.in {
+			v, _, _ := parseSemver(s)
+			if err := c.check(v, "required"); err != nil {
+				t.Errorf("%s should satisfy %q: %v", s, tc.constraint, err)
+			}
+		}
+		for _, s := range tc.out {
+			v, _, _ := parseSemver(s)
+			if c.check(v, "required") == nil {
+				t.Errorf("%s should not satisfy %q", s, tc.constraint)
+			}
+		}
+	}
+}
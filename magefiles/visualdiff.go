@@ -0,0 +1,355 @@
+//go:build mage
+
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// visualDiffDir holds the scratch render, diff images and report. It lives
+// inside the repo (under the ignored build/) so container rendering, which
+// only mounts the repo, can write to it.
+const visualDiffDir = "build/visual-diff"
+
+// Visual diff defaults: a pixel counts as changed when any channel differs by
+// more than diffThreshold, and a diagram counts as changed when more than
+// diffTolerance percent of its pixels did.
+const (
+	defaultDiffThreshold = 16
+	defaultDiffTolerance = 0.0
+)
+
+// visualDiff is the comparison of one rendered PNG with its committed version.
+type visualDiff struct {
+	Name       string
+	Status     string // "unchanged", "changed", "added" or "removed"
+	Changed    int
+	Total      int
+	Percent    float64
+	SizeChange string
+	Old, New   string // report-relative image paths
+	Diff       string
+}
+
+// Diff renders every diagram into a scratch directory and pixel-diffs each PNG
+// against the committed gen/png version. DIFF_THRESHOLD sets the per-channel
+// difference (0-255, default 16) below which pixels count as equal, and
+// DIFF_TOLERANCE the percentage of changed pixels allowed (default 0). Diff
+// images and report.html are written to build/visual-diff.
+func (Diagrams) Diff() error {
+	fmt.Println("🔍 Rendering diagrams for visual comparison with", genPNGDir+"...")
+
+	threshold, err := envInt("DIFF_THRESHOLD", defaultDiffThreshold)
+	if err != nil {
+		return err
+	}
+	tolerance, err := envFloat("DIFF_TOLERANCE", defaultDiffTolerance)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadProjectConfig()
+	if err != nil {
+		return err
+	}
+	renderDir := filepath.Join(visualDiffDir, "rendered")
+	if err := os.RemoveAll(visualDiffDir); err != nil {
+		return err
+	}
+	if err := ensureDir(renderDir); err != nil {
+		return err
+	}
+	if err := renderAll(cfg, renderDir); err != nil {
+		return err
+	}
+
+	names, err := pngNames(genPNGDir, renderDir)
+	if err != nil {
+		return err
+	}
+
+	var diffs []visualDiff
+	changed := 0
+	fmt.Println()
+	for _, name := range names {
+		d, err := compareDiagram(name, renderDir, threshold, tolerance)
+		if err != nil {
+			return fmt.Errorf("failed to compare %s: %w", name, err)
+		}
+		diffs = append(diffs, d)
+
+		switch d.Status {
+		case "unchanged":
+			fmt.Printf("✅ %-40s %6.2f%% pixels differ\n", name, d.Percent)
+		case "changed":
+			changed++
+			fmt.Printf("❌ %-40s %6.2f%% pixels differ%s\n", name, d.Percent, d.SizeChange)
+		default:
+			changed++
+			fmt.Printf("⚠️  %-40s %s\n", name, d.Status)
+		}
+	}
+
+	reportPath := filepath.Join(visualDiffDir, "report.html")
+	if err := writeVisualDiffReport(reportPath, diffs, threshold, tolerance); err != nil {
+		return err
+	}
+	fmt.Printf("\n📄 Report: %s\n", reportPath)
+
+	if changed > 0 {
+		return fmt.Errorf("%d of %d diagrams changed visually", changed, len(diffs))
+	}
+	fmt.Printf("✅ No visual changes in %d diagrams.\n", len(diffs))
+	return nil
+}
+
+// compareDiagram diffs one PNG name between genPNGDir and renderDir and writes
+// the copies and diff image the report links to.
+func compareDiagram(name, renderDir string, threshold int, tolerance float64) (visualDiff, error) {
+	d := visualDiff{Name: name}
+	base := name[:len(name)-len(filepath.Ext(name))]
+	oldPath := filepath.Join(genPNGDir, name)
+	newPath := filepath.Join(renderDir, name)
+
+	oldImg, oldErr := readPNG(oldPath)
+	newImg, newErr := readPNG(newPath)
+	switch {
+	case os.IsNotExist(oldErr) && newErr == nil:
+		d.Status, d.New = "added", "rendered/"+name
+		return d, nil
+	case os.IsNotExist(newErr) && oldErr == nil:
+		d.Status = "removed"
+		d.Old = base + ".old.png"
+		return d, copyFile(oldPath, filepath.Join(visualDiffDir, d.Old))
+	case oldErr != nil:
+		return d, oldErr
+	case newErr != nil:
+		return d, newErr
+	}
+
+	diffImg, changed, total := pixelDiff(oldImg, newImg, threshold)
+	d.Changed, d.Total = changed, total
+	d.Percent = 100 * float64(changed) / float64(total)
+	if ob, nb := oldImg.Bounds(), newImg.Bounds(); ob.Size() != nb.Size() {
+		d.SizeChange = fmt.Sprintf(" (size %dx%d → %dx%d)", ob.Dx(), ob.Dy(), nb.Dx(), nb.Dy())
+	}
+
+	d.Status = "unchanged"
+	if d.SizeChange != "" || (changed > 0 && d.Percent > tolerance) {
+		d.Status = "changed"
+	}
+	if d.Status == "unchanged" {
+		return d, nil
+	}
+
+	d.Old, d.New, d.Diff = base+".old.png", "rendered/"+name, base+".diff.png"
+	if err := copyFile(oldPath, filepath.Join(visualDiffDir, d.Old)); err != nil {
+		return d, err
+	}
+	return d, writePNG(filepath.Join(visualDiffDir, d.Diff), diffImg)
+}
+
+// pixelDiff compares two images over the union of their bounds. The returned
+// image is the old image faded to light grey with changed pixels in red and
+// the bounding box of all changes outlined in magenta.
+func pixelDiff(oldImg, newImg image.Image, threshold int) (*image.NRGBA, int, int) {
+	ob, nb := oldImg.Bounds(), newImg.Bounds()
+	w, h := max(ob.Dx(), nb.Dx()), max(ob.Dy(), nb.Dy())
+	out := image.NewNRGBA(image.Rect(0, 0, w, h))
+
+	red := color.NRGBA{R: 0xE5, G: 0x1A, B: 0x1A, A: 0xFF}
+	box := image.Rectangle{}
+	changed := 0
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			op, oIn := pixelAt(oldImg, ob.Min.X+x, ob.Min.Y+y)
+			np, nIn := pixelAt(newImg, nb.Min.X+x, nb.Min.Y+y)
+
+			if oIn != nIn || channelDelta(op, np) > threshold {
+				changed++
+				out.SetNRGBA(x, y, red)
+				box = box.Union(image.Rect(x, y, x+1, y+1))
+				continue
+			}
+			// Fade unchanged pixels so the red stands out.
+			g := uint8((int(op.R)+int(op.G)+int(op.B))/3/4 + 0xBF)
+			out.SetNRGBA(x, y, color.NRGBA{R: g, G: g, B: g, A: 0xFF})
+		}
+	}
+
+	if !box.Empty() {
+		outline(out, box.Inset(-4).Intersect(out.Bounds()), color.NRGBA{R: 0xD0, B: 0xD0, A: 0xFF})
+	}
+	return out, changed, w * h
+}
+
+// pixelAt returns the colour at (x, y) and whether it lies inside img.
+func pixelAt(img image.Image, x, y int) (color.NRGBA, bool) {
+	if !(image.Point{X: x, Y: y}).In(img.Bounds()) {
+		return color.NRGBA{}, false
+	}
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA), true
+}
+
+// channelDelta returns the largest per-channel difference between two colours.
+func channelDelta(a, b color.NRGBA) int {
+	d := 0
+	for _, p := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}, {a.A, b.A}} {
+		diff := int(p[0]) - int(p[1])
+		if diff < 0 {
+			diff = -diff
+		}
+		d = max(d, diff)
+	}
+	return d
+}
+
+// outline draws a 2px rectangle border.
+func outline(img draw.Image, r image.Rectangle, c color.Color) {
+	for _, edge := range []image.Rectangle{
+		image.Rect(r.Min.X, r.Min.Y, r.Max.X, r.Min.Y+2),
+		image.Rect(r.Min.X, r.Max.Y-2, r.Max.X, r.Max.Y),
+		image.Rect(r.Min.X, r.Min.Y, r.Min.X+2, r.Max.Y),
+		image.Rect(r.Max.X-2, r.Min.Y, r.Max.X, r.Max.Y),
+	} {
+		draw.Draw(img, edge.Intersect(r), &image.Uniform{C: c}, image.Point{}, draw.Src)
+	}
+}
+
+// pngNames returns the sorted union of PNG file names in the given directories.
+func pngNames(dirs ...string) ([]string, error) {
+	seen := map[string]bool{}
+	var names []string
+	for _, dir := range dirs {
+		matches, err := filepath.Glob(filepath.Join(dir, "*.png"))
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range matches {
+			if name := filepath.Base(m); !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// readPNG decodes a PNG file.
+func readPNG(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// writePNG encodes img to path.
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// envInt returns an integer environment variable, or def when unset.
+func envInt(name string, def int) (int, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, v, err)
+	}
+	return n, nil
+}
+
+// envFloat returns a floating-point environment variable, or def when unset.
+func envFloat(name string, def float64) (float64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return def, nil
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, v, err)
+	}
+	return f, nil
+}
+
+var visualDiffTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Diagram visual diff</title>
+<style>
+  body { font-family: sans-serif; margin: 2rem; background: #f6f6f8; color: #222; }
+  section { background: #fff; border: 1px solid #ddd; border-radius: 6px; padding: 1rem; margin-bottom: 1.5rem; }
+  .row { display: flex; gap: 1rem; align-items: flex-start; }
+  figure { margin: 0; flex: 1; min-width: 0; }
+  figure img { max-width: 100%; border: 1px solid #ccc; background: repeating-conic-gradient(#eee 0 25%, #fff 0 50%) 0 0 / 16px 16px; }
+  figcaption { font-size: .85rem; color: #666; margin-bottom: .25rem; }
+  .changed { color: #b00; } .added { color: #070; } .removed { color: #a60; }
+</style>
+</head>
+<body>
+<h1>Diagram visual diff</h1>
+<p>Threshold {{.Threshold}} per channel, tolerance {{printf "%.2f" .Tolerance}}% of pixels.
+{{len .Changed}} of {{.Total}} diagrams changed.</p>
+{{range .Changed}}
+<section>
+  <h2 class="{{.Status}}">{{.Name}} — {{.Status}}{{if eq .Status "changed"}} ({{printf "%.2f" .Percent}}% of pixels{{.SizeChange}}){{end}}</h2>
+  <div class="row">
+    {{if .Old}}<figure><figcaption>committed</figcaption><img src="{{.Old}}" alt="committed {{.Name}}"></figure>{{end}}
+    {{if .New}}<figure><figcaption>rendered</figcaption><img src="{{.New}}" alt="rendered {{.Name}}"></figure>{{end}}
+    {{if .Diff}}<figure><figcaption>diff</figcaption><img src="{{.Diff}}" alt="diff of {{.Name}}"></figure>{{end}}
+  </div>
+</section>
+{{else}}
+<p>No visual changes.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// writeVisualDiffReport writes an HTML page showing every changed diagram.
+func writeVisualDiffReport(path string, diffs []visualDiff, threshold int, tolerance float64) error {
+	var changed []visualDiff
+	for _, d := range diffs {
+		if d.Status != "unchanged" {
+			changed = append(changed, d)
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = visualDiffTemplate.Execute(f, struct {
+		Threshold int
+		Tolerance float64
+		Total     int
+		Changed   []visualDiff
+	}{threshold, tolerance, len(diffs), changed})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
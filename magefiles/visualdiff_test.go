@@ -0,0 +1,78 @@
+//go:build mage
+
+package main
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// solidImage returns a w×h image filled with c, with the given pixels recoloured.
+func solidImage(w, h int, c color.NRGBA, pixels map[image.Point]color.NRGBA) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	for p, pc := range pixels {
+		img.SetNRGBA(p.X, p.Y, pc)
+	}
+	return img
+}
+
+func TestPixelDiff(t *testing.T) {
+	white := color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	base := solidImage(4, 4, white, nil)
+	for _, tc := range []struct {
+		name           string
+		newImg         image.Image
+		threshold      int
+		changed, total int
+	}{
+		{"identical", solidImage(4, 4, white, nil), 16, 0, 16},
+		{"below threshold", solidImage(4, 4, white, map[image.Point]color.NRGBA{{1, 1}: {0xF0, 0xFF, 0xFF, 0xFF}}), 16, 0, 16},
+		{"at threshold", solidImage(4, 4, white, map[image.Point]color.NRGBA{{1, 1}: {0xEF, 0xFF, 0xFF, 0xFF}}), 16, 0, 16},
+		{"above threshold", solidImage(4, 4, white, map[image.Point]color.NRGBA{{1, 1}: {0xEE, 0xFF, 0xFF, 0xFF}}), 16, 1, 16},
+		{"zero threshold", solidImage(4, 4, white, map[image.Point]color.NRGBA{{0, 0}: {0xFE, 0xFF, 0xFF, 0xFF}, {3, 3}: {}}), 0, 2, 16},
+		{"alpha only", solidImage(4, 4, white, map[image.Point]color.NRGBA{{2, 0}: {0xFF, 0xFF, 0xFF, 0x00}}), 16, 1, 16},
+		{"wider", solidImage(6, 4, white, nil), 16, 8, 24},
+		{"smaller", solidImage(2, 2, white, nil), 16, 12, 16},
+		{"offset bounds", solidImage(6, 6, white, nil).SubImage(image.Rect(2, 2, 6, 6)), 16, 0, 16},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, changed, total := pixelDiff(base, tc.newImg, tc.threshold)
+			if changed != tc.changed || total != tc.total {
+				t.Errorf("changed %d of %d, want %d of %d", changed, total, tc.changed, tc.total)
+			}
+			if b := out.Bounds(); b.Dx()*b.Dy() != total {
+				t.Errorf("diff image is %v for %d pixels", b, total)
+			}
+		})
+	}
+
+	// Changed pixels are painted red in the diff image, inside an outline.
+	big := solidImage(16, 16, white, nil)
+	out, _, _ := pixelDiff(big, solidImage(16, 16, white, map[image.Point]color.NRGBA{{8, 8}: {A: 0xFF}}), 16)
+	if got := out.NRGBAAt(8, 8); got != (color.NRGBA{R: 0xE5, G: 0x1A, B: 0x1A, A: 0xFF}) {
+		t.Errorf("changed pixel drawn as %v, want red", got)
+	}
+}
+
+func TestDiffLeavesGenUntouched(t *testing.T) {
+	fakeRenderTree(t)
+	writeTestPNG(t, filepath.Join(genPNGDir, "d.png"), 120, 80)
+
+	if err := (Diagrams{}).Diff(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(genMMDDir); err == nil {
+		t.Errorf("Diff wrote extracted sources into %s", genMMDDir)
+	}
+	if _, err := os.Stat(filepath.Join(visualDiffDir, "report.html")); err != nil {
+		t.Errorf("no report: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+//go:build mage
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// wikiJSClient talks to the Wiki.js 2.x GraphQL asset API and its /u upload endpoint.
+type wikiJSClient struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+// wikiJSAsset is an asset entry returned by assets.list.
+type wikiJSAsset struct {
+	ID       int    `json:"id"`
+	Filename string `json:"filename"`
+	FileSize int64  `json:"fileSize"`
+}
+
+// wikiJSFolder is a folder entry returned by assets.folders.
+type wikiJSFolder struct {
+	ID   int    `json:"id"`
+	Slug string `json:"slug"`
+}
+
+// wikiJSResponseResult is the status block Wiki.js mutations return.
+type wikiJSResponseResult struct {
+	Succeeded bool   `json:"succeeded"`
+	ErrorCode int    `json:"errorCode"`
+	Message   string `json:"message"`
+}
+
+func newWikiJSClient(baseURL, token string) *wikiJSClient {
+	return &wikiJSClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// graphql runs a query and decodes its data field into out.
+func (c *wikiJSClient) graphql(query string, vars map[string]any, out any) error {
+	body, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/graphql", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("Wiki.js GraphQL request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("Wiki.js GraphQL returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode Wiki.js GraphQL response: %w", err)
+	}
+	if len(envelope.Errors) > 0 {
+		return fmt.Errorf("Wiki.js GraphQL error: %s", envelope.Errors[0].Message)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
+
+// folders lists the sub-folders of a folder (0 is the asset root).
+func (c *wikiJSClient) folders(parentID int) ([]wikiJSFolder, error) {
+	var data struct {
+		Assets struct {
+			Folders []wikiJSFolder `json:"folders"`
+		} `json:"assets"`
+	}
+	err := c.graphql(`query ($parentFolderId: Int!) {
+  assets { folders(parentFolderId: $parentFolderId) { id slug } }
+}`, map[string]any{"parentFolderId": parentID}, &data)
+	return data.Assets.Folders, err
+}
+
+// createFolder creates a folder under parentID.
+func (c *wikiJSClient) createFolder(parentID int, slug string) error {
+	var data struct {
+		Assets struct {
+			CreateFolder struct {
+				ResponseResult wikiJSResponseResult `json:"responseResult"`
+			} `json:"createFolder"`
+		} `json:"assets"`
+	}
+	err := c.graphql(`mutation ($parentFolderId: Int!, $slug: String!) {
+  assets { createFolder(parentFolderId: $parentFolderId, slug: $slug) { responseResult { succeeded errorCode message } } }
+}`, map[string]any{"parentFolderId": parentID, "slug": slug}, &data)
+	if err != nil {
+		return err
+	}
+	if r := data.Assets.CreateFolder.ResponseResult; !r.Succeeded {
+		return fmt.Errorf("failed to create Wiki.js folder %s: %s", slug, r.Message)
+	}
+	return nil
+}
+
+// ensureFolderPath resolves a slash-separated folder path, creating missing folders.
+func (c *wikiJSClient) ensureFolderPath(path string) (int, error) {
+	id := 0
+	for _, slug := range strings.Split(strings.Trim(path, "/"), "/") {
+		if slug == "" {
+			continue
+		}
+		next, err := c.findFolder(id, slug)
+		if err != nil {
+			return 0, err
+		}
+		if next == 0 {
+			fmt.Printf("📁 Creating Wiki.js folder %s\n", slug)
+			if err := c.createFolder(id, slug); err != nil {
+				return 0, err
+			}
+			if next, err = c.findFolder(id, slug); err != nil {
+				return 0, err
+			}
+			if next == 0 {
+				return 0, fmt.Errorf("Wiki.js folder %s was not found after creation", slug)
+			}
+		}
+		id = next
+	}
+	return id, nil
+}
+
+// findFolder returns the id of slug under parentID, or 0 when it does not exist.
+func (c *wikiJSClient) findFolder(parentID int, slug string) (int, error) {
+	folders, err := c.folders(parentID)
+	if err != nil {
+		return 0, err
+	}
+	for _, f := range folders {
+		if f.Slug == slug {
+			return f.ID, nil
+		}
+	}
+	return 0, nil
+}
+
+// assets lists the assets stored in a folder.
+func (c *wikiJSClient) assets(folderID int) ([]wikiJSAsset, error) {
+	var data struct {
+		Assets struct {
+			List []wikiJSAsset `json:"list"`
+		} `json:"assets"`
+	}
+	err := c.graphql(`query ($folderId: Int!, $kind: AssetKind!) {
+  assets { list(folderId: $folderId, kind: $kind) { id filename fileSize } }
+}`, map[string]any{"folderId": folderID, "kind": "ALL"}, &data)
+	return data.Assets.List, err
+}
+
+// upload sends a file to the /u endpoint. Wiki.js replaces an existing asset
+// with the same filename in the same folder.
+func (c *wikiJSClient) upload(folderID int, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+
+	// The first mediaUpload part carries the target folder as JSON.
+	if err := w.WriteField("mediaUpload", fmt.Sprintf(`{"folderId":%d}`, folderID)); err != nil {
+		return err
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="mediaUpload"; filename="%s"`, filepath.Base(path)))
+	h.Set("Content-Type", http.DetectContentType(data))
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	if _, err := part.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/u", &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.token)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("upload of %s failed: %w", filepath.Base(path), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("upload of %s returned %s: %s", filepath.Base(path), resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,310 @@
+//go:build mage
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeWikiJS is an in-memory stand-in for the Wiki.js GraphQL asset API and
+// its /u upload endpoint.
+type fakeWikiJS struct {
+	t     *testing.T
+	token string
+
+	mu      sync.Mutex
+	folders []fakeWikiJSFolder
+	assets  []fakeWikiJSAsset
+	created []string // slugs passed to createFolder
+	uploads []string // filenames received by /u
+}
+
+type fakeWikiJSFolder struct {
+	id, parent int
+	slug       string
+}
+
+type fakeWikiJSAsset struct {
+	folder   int
+	filename string
+	mime     string
+	data     string
+}
+
+func newFakeWikiJS(t *testing.T) (*fakeWikiJS, *httptest.Server) {
+	f := &fakeWikiJS{t: t, token: "test-token"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /graphql", f.graphql)
+	mux.HandleFunc("POST /u", f.upload)
+	srv := httptest.NewServer(f.authorized(mux))
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeWikiJS) authorized(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+f.token {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (f *fakeWikiJS) addFolder(parent int, slug string) int {
+	id := len(f.folders) + 1
+	f.folders = append(f.folders, fakeWikiJSFolder{id: id, parent: parent, slug: slug})
+	return id
+}
+
+func (f *fakeWikiJS) graphql(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query     string         `json:"query"`
+		Variables map[string]any `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	intVar := func(name string) int { n, _ := req.Variables[name].(float64); return int(n) }
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var data map[string]any
+	switch {
+	case strings.Contains(req.Query, "createFolder("):
+		parent, slug := intVar("parentFolderId"), req.Variables["slug"].(string)
+		f.created = append(f.created, slug)
+		f.addFolder(parent, slug)
+		data = map[string]any{"assets": map[string]any{"createFolder": map[string]any{
+			"responseResult": map[string]any{"succeeded": true, "errorCode": 0, "message": "ok"},
+		}}}
+	case strings.Contains(req.Query, "folders("):
+		var list []map[string]any
+		for _, folder := range f.folders {
+			if folder.parent == intVar("parentFolderId") {
+				list = append(list, map[string]any{"id": folder.id, "slug": folder.slug})
+			}
+		}
+		data = map[string]any{"assets": map[string]any{"folders": list}}
+	case strings.Contains(req.Query, "list("):
+		var list []map[string]any
+		for i, a := range f.assets {
+			if a.folder == intVar("folderId") {
+				list = append(list, map[string]any{"id": i + 1, "filename": a.filename, "fileSize": len(a.data)})
+			}
+		}
+		data = map[string]any{"assets": map[string]any{"list": list}}
+	default:
+		f.t.Errorf("unexpected GraphQL query: %s", req.Query)
+		http.Error(w, "unexpected query", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+// upload mirrors Wiki.js: the first mediaUpload part holds the folder as
+// JSON, the second the file, which replaces an asset of the same name.
+func (f *fakeWikiJS) upload(w http.ResponseWriter, r *http.Request) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var meta struct {
+		FolderID int `json:"folderId"`
+	}
+	part, err := mr.NextPart()
+	if err != nil || part.FormName() != "mediaUpload" || part.FileName() != "" {
+		http.Error(w, "first part must be the mediaUpload folder field", http.StatusBadRequest)
+		return
+	}
+	if err := json.NewDecoder(part).Decode(&meta); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	part, err = mr.NextPart()
+	if err != nil || part.FormName() != "mediaUpload" || part.FileName() == "" {
+		http.Error(w, "second part must be the mediaUpload file", http.StatusBadRequest)
+		return
+	}
+	data, err := io.ReadAll(part)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads = append(f.uploads, part.FileName())
+	asset := fakeWikiJSAsset{folder: meta.FolderID, filename: part.FileName(), mime: part.Header.Get("Content-Type"), data: string(data)}
+	for i, a := range f.assets {
+		if a.folder == asset.folder && a.filename == asset.filename {
+			f.assets[i] = asset
+			w.Write([]byte("ok"))
+			return
+		}
+	}
+	f.assets = append(f.assets, asset)
+	w.Write([]byte("ok"))
+}
+
+func TestWikiJSEnsureFolderPath(t *testing.T) {
+	f, srv := newFakeWikiJS(t)
+	docs := f.addFolder(0, "docs")
+	c := newWikiJSClient(srv.URL+"/", f.token)
+
+	id, err := c.ensureFolderPath("docs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != docs || len(f.created) != 0 {
+		t.Errorf("existing folder: id %d, created %v; want id %d and no creates", id, f.created, docs)
+	}
+
+	id, err = c.ensureFolderPath("/docs/diagrams/network/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(f.created, ",") != "diagrams,network" {
+		t.Errorf("created %v, want [diagrams network]", f.created)
+	}
+	network := f.folders[id-1]
+	diagrams := f.folders[network.parent-1]
+	if network.slug != "network" || diagrams.slug != "diagrams" || diagrams.parent != docs {
+		t.Errorf("nested folders created as %+v under %+v", network, diagrams)
+	}
+
+	again, err := c.ensureFolderPath("docs/diagrams/network")
+	if err != nil || again != id || len(f.created) != 2 {
+		t.Errorf("second resolve = %d, %v (created %v); want %d without new folders", again, err, f.created, id)
+	}
+}
+
+func TestPublishWikiJSUploadsAndReplaces(t *testing.T) {
+	f, srv := newFakeWikiJS(t)
+	folder := f.addFolder(0, "diagrams")
+	f.assets = append(f.assets,
+		fakeWikiJSAsset{folder: folder, filename: "a.png", data: "old"},
+		fakeWikiJSAsset{folder: folder, filename: "unrelated.png", data: "keep"},
+	)
+
+	t.Chdir(t.TempDir())
+	t.Setenv("WIKIJS_URL", srv.URL)
+	t.Setenv("WIKIJS_API_TOKEN", f.token)
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+	for _, name := range []string{"a.png", "b.png"} {
+		path := filepath.Join(genPNGDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(png+name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := newWikiJSClient(srv.URL, f.token)
+	listed, err := c.assets(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed) != 2 || listed[0].Filename != "a.png" || listed[0].FileSize != 3 {
+		t.Errorf("assets(%d) = %+v", folder, listed)
+	}
+
+	if err := (Publish{}).WikiJS(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(f.uploads, ",") != "a.png,b.png" {
+		t.Errorf("uploads = %v, want [a.png b.png]", f.uploads)
+	}
+	want := map[string]string{"a.png": png + "a.png", "b.png": png + "b.png", "unrelated.png": "keep"}
+	if len(f.assets) != len(want) {
+		t.Errorf("folder holds %d assets after publishing, want %d (a.png replaced in place)", len(f.assets), len(want))
+	}
+	for _, a := range f.assets {
+		if a.folder != folder || a.data != want[a.filename] {
+			t.Errorf("asset %s in folder %d = %q, want %q in folder %d", a.filename, a.folder, a.data, want[a.filename], folder)
+		}
+		if a.filename != "unrelated.png" && a.mime != "image/png" {
+			t.Errorf("asset %s uploaded as %q, want image/png", a.filename, a.mime)
+		}
+	}
+}
+
+func TestWikiJSErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		handler http.HandlerFunc
+		want    string
+	}{
+		{
+			name: "graphql errors",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"data":null,"errors":[{"message":"Forbidden"}]}`))
+			},
+			want: "Wiki.js GraphQL error: Forbidden",
+		},
+		{
+			name: "graphql non-2xx",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "maintenance", http.StatusServiceUnavailable)
+			},
+			want: "Wiki.js GraphQL returned 503 Service Unavailable: maintenance",
+		},
+		{
+			name: "createFolder not succeeded",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if strings.Contains(string(body), "createFolder") {
+					w.Write([]byte(`{"data":{"assets":{"createFolder":{"responseResult":{"succeeded":false,"errorCode":6001,"message":"slug taken"}}}}}`))
+					return
+				}
+				w.Write([]byte(`{"data":{"assets":{"folders":[]}}}`))
+			},
+			want: "failed to create Wiki.js folder diagrams: slug taken",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(tc.handler)
+			defer srv.Close()
+			_, err := newWikiJSClient(srv.URL, "token").ensureFolderPath("diagrams")
+			if err == nil || err.Error() != tc.want {
+				t.Errorf("ensureFolderPath error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+
+	t.Run("upload non-2xx", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		}))
+		defer srv.Close()
+		path := filepath.Join(t.TempDir(), "big.png")
+		if err := os.WriteFile(path, []byte("png"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := newWikiJSClient(srv.URL, "token").upload(1, path)
+		if want := "upload of big.png returned 413 Request Entity Too Large: file too large"; err == nil || err.Error() != want {
+			t.Errorf("upload error = %v, want %q", err, want)
+		}
+	})
+
+	t.Run("rejected token", func(t *testing.T) {
+		_, srv := newFakeWikiJS(t)
+		_, err := newWikiJSClient(srv.URL, "wrong").assets(0)
+		if err == nil || !strings.Contains(err.Error(), "401 Unauthorized") {
+			t.Errorf("assets with a bad token: error = %v, want 401", err)
+		}
+	})
+}